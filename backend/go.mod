@@ -13,6 +13,7 @@ require (
 	github.com/golang/geo v0.0.0-20210211234256-740aa86cb551
 	github.com/jackc/pgx/v4 v4.18.2
 	github.com/markus-wa/demoinfocs-golang/v2 v2.12.0
+	github.com/markus-wa/godispatch v1.4.1
 	golang.org/x/crypto v0.20.0
 )
 
@@ -42,7 +43,6 @@ require (
 	github.com/leodido/go-urn v1.2.4 // indirect
 	github.com/markus-wa/go-unassert v0.1.2 // indirect
 	github.com/markus-wa/gobitread v0.2.3 // indirect
-	github.com/markus-wa/godispatch v1.4.1 // indirect
 	github.com/markus-wa/quickhull-go/v2 v2.1.0 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
@@ -0,0 +1 @@
+ALTER TABLE matches ADD COLUMN heatmaps JSON NOT NULL DEFAULT '{}';
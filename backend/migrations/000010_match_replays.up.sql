@@ -0,0 +1 @@
+ALTER TABLE matches ADD COLUMN replays JSON NOT NULL DEFAULT '[]';
@@ -0,0 +1,2 @@
+DROP TABLE parse_jobs;
+DROP TABLE rescans;
@@ -0,0 +1,32 @@
+CREATE TABLE rescans (
+  id SERIAL PRIMARY KEY,
+  -- cron, api, retry, etc.
+  trigger TEXT NOT NULL,
+  -- unix millis
+  started_at BIGINT NOT NULL,
+  finished_at BIGINT,
+  -- number of demos that needed to be parsed
+  total INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE parse_jobs (
+  id SERIAL PRIMARY KEY,
+  demo_id TEXT NOT NULL,
+  path TEXT NOT NULL,
+  -- null if the demo was parsed outside of a rescan (e.g. the file watcher)
+  rescan_id INTEGER,
+
+  -- queued, running, done or failed
+  status TEXT NOT NULL,
+  error TEXT,
+
+  -- unix millis
+  queued_at BIGINT NOT NULL,
+  started_at BIGINT,
+  finished_at BIGINT,
+
+  FOREIGN KEY (rescan_id) REFERENCES rescans (id) ON DELETE SET NULL
+);
+
+CREATE INDEX parse_jobs_demo_id_idx ON parse_jobs (demo_id);
+CREATE INDEX parse_jobs_rescan_id_idx ON parse_jobs (rescan_id);
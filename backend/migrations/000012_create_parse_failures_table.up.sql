@@ -0,0 +1,13 @@
+CREATE TABLE parse_failures (
+  demo_id TEXT PRIMARY KEY,
+  path TEXT NOT NULL,
+  -- the error from the most recent attempt
+  error TEXT NOT NULL,
+  attempts INTEGER NOT NULL,
+
+  -- unix millis
+  first_failed_at BIGINT NOT NULL,
+  last_failed_at BIGINT NOT NULL,
+  -- null once the demo has used up all of its attempts
+  next_retry_at BIGINT
+);
@@ -0,0 +1,2 @@
+ALTER TABLE matches DROP COLUMN incomplete_reason;
+ALTER TABLE matches DROP COLUMN incomplete;
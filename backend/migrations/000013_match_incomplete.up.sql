@@ -0,0 +1,2 @@
+ALTER TABLE matches ADD COLUMN incomplete BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE matches ADD COLUMN incomplete_reason TEXT;
@@ -0,0 +1 @@
+DROP TABLE match_parts;
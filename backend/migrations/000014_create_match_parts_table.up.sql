@@ -0,0 +1,14 @@
+-- Demo files which make up a single match. The match is stored
+-- under the ID of its first demo. A match with a single part is
+-- one that was split back up by an admin and should not be
+-- merged automatically again
+CREATE TABLE match_parts (
+  demo_id TEXT PRIMARY KEY,
+  match_id TEXT NOT NULL,
+  part INTEGER NOT NULL,
+  -- whether the parts were grouped by the automatic detection
+  -- rather than by an admin
+  automatic BOOLEAN NOT NULL
+);
+
+CREATE INDEX match_parts_match_id_idx ON match_parts (match_id);
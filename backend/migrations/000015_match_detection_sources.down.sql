@@ -0,0 +1,2 @@
+ALTER TABLE matches DROP COLUMN date_source;
+ALTER TABLE matches DROP COLUMN demo_type_source;
@@ -0,0 +1,2 @@
+ALTER TABLE matches ADD COLUMN demo_type_source TEXT;
+ALTER TABLE matches ADD COLUMN date_source TEXT;
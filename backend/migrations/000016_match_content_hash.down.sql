@@ -0,0 +1,8 @@
+ALTER TABLE usermeta
+  DROP CONSTRAINT usermeta_mapid_fkey,
+  ADD CONSTRAINT usermeta_mapid_fkey
+    FOREIGN KEY (mapid) REFERENCES matches (id) ON DELETE CASCADE;
+
+DROP TABLE duplicate_demos;
+DROP INDEX matches_content_hash_idx;
+ALTER TABLE matches DROP COLUMN content_hash;
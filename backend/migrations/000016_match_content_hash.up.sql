@@ -0,0 +1,22 @@
+-- sha256 of the match's (first) demo file, used to recognize
+-- the demo again if it is renamed, moved or copied
+ALTER TABLE matches ADD COLUMN content_hash TEXT;
+CREATE INDEX matches_content_hash_idx ON matches (content_hash);
+
+-- Demo files with the same contents as a demo that already has a match.
+-- These are not parsed again
+CREATE TABLE duplicate_demos (
+  demo_id TEXT PRIMARY KEY,
+  match_id TEXT NOT NULL,
+  content_hash TEXT NOT NULL,
+
+  -- unix millis
+  detected_at BIGINT NOT NULL
+);
+
+-- Renamed demos keep their match, so the user metadata
+-- needs to follow the match's ID
+ALTER TABLE usermeta
+  DROP CONSTRAINT usermeta_mapid_fkey,
+  ADD CONSTRAINT usermeta_mapid_fkey
+    FOREIGN KEY (mapid) REFERENCES matches (id) ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE matches ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
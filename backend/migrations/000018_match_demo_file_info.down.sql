@@ -0,0 +1,3 @@
+ALTER TABLE matches DROP COLUMN demo_missing;
+ALTER TABLE matches DROP COLUMN demo_mtime;
+ALTER TABLE matches DROP COLUMN demo_size;
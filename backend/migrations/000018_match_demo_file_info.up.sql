@@ -0,0 +1,6 @@
+-- Size and modification time (unix millis) of the match's (first) demo
+-- file when it was parsed, used to cheaply tell if the demo has changed
+ALTER TABLE matches ADD COLUMN demo_size BIGINT;
+ALTER TABLE matches ADD COLUMN demo_mtime BIGINT;
+-- Set when the demo file is removed from the demos folder
+ALTER TABLE matches ADD COLUMN demo_missing BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,15 @@
+-- Demo uploads which haven't finished yet. The chunks are written to
+-- a hidden file in the upload folder until the whole demo is there
+CREATE TABLE uploads (
+  id TEXT PRIMARY KEY,
+  username TEXT NOT NULL,
+  file_name TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  temp_path TEXT NOT NULL,
+
+  -- unix millis
+  created_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL,
+
+  FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE ON UPDATE CASCADE
+);
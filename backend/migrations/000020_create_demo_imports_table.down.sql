@@ -0,0 +1,2 @@
+ALTER TABLE matches DROP COLUMN source_url;
+DROP TABLE demo_imports;
@@ -0,0 +1,28 @@
+-- Demos downloaded from a URL through the API or the import command
+CREATE TABLE demo_imports (
+  id SERIAL PRIMARY KEY,
+  url TEXT NOT NULL,
+  -- null if the demo was imported from the command line
+  username TEXT,
+
+  -- queued, downloading, done or failed
+  status TEXT NOT NULL,
+  -- set once the file name is known
+  demo_id TEXT,
+  -- bytes downloaded so far and the total size if the server sent it
+  received BIGINT NOT NULL DEFAULT 0,
+  total BIGINT,
+  error TEXT,
+  parse_job_id INTEGER,
+
+  -- unix millis
+  created_at BIGINT NOT NULL,
+  finished_at BIGINT,
+
+  FOREIGN KEY (username) REFERENCES users (username) ON DELETE SET NULL ON UPDATE CASCADE,
+  FOREIGN KEY (parse_job_id) REFERENCES parse_jobs (id) ON DELETE SET NULL
+);
+
+CREATE INDEX demo_imports_demo_id_idx ON demo_imports (demo_id);
+
+ALTER TABLE matches ADD COLUMN source_url TEXT;
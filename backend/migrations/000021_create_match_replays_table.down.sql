@@ -0,0 +1,11 @@
+ALTER TABLE matches ADD COLUMN replays JSON NOT NULL DEFAULT '[]';
+
+UPDATE matches
+SET replays = (
+  SELECT json_agg(replay ORDER BY round)
+  FROM match_replays
+  WHERE match_id = matches.id
+)
+WHERE id IN (SELECT match_id FROM match_replays);
+
+DROP TABLE match_replays;
@@ -0,0 +1,15 @@
+-- Replays are most of a match's data, so each round's replay gets
+-- its own row and is only loaded when that round is being watched
+CREATE TABLE match_replays (
+  match_id TEXT NOT NULL,
+  -- zero-indexed
+  round INTEGER NOT NULL,
+  replay JSON NOT NULL,
+  PRIMARY KEY (match_id, round)
+);
+
+INSERT INTO match_replays (match_id, round, replay)
+  SELECT id, replay.round - 1, replay.value
+  FROM matches, json_array_elements(replays) WITH ORDINALITY AS replay(value, round);
+
+ALTER TABLE matches DROP COLUMN replays;
@@ -26,6 +26,27 @@ import (
 	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
 )
 
+// Team equipment value thresholds used to classify buys. These are roughly
+// the same brackets HLTV uses for its economy tab
+const (
+	EcoMaxEquipment     = 5000
+	FullBuyMinEquipment = 20000
+	// If the team has less than this much money left over after buying
+	// we will consider it a force buy rather than a half-buy
+	ForceBuyMaxLeftover = 2500
+)
+
+// If a player goes this long without shooting we will assume the
+// recoil has reset and count their next shot as a first bullet
+const FirstBulletResetMs = 500
+
+// MR3 overtime is the default for both Valve servers and
+// every league config we've seen so far
+const DefaultOvertimeHalfLength = 3
+
+// Regulation half lengths for MR15, MR12 and short matches
+var KnownHalfLengths = []int{15, 12, 8}
+
 func computeRWS(
 	winners [][]uint64,
 	rounds []Round,
@@ -200,6 +221,64 @@ func computeMultikills(kills []PlayerIntMap) (PlayerIntMap, PlayerIntMap, Player
 	return k2, k3, k4, k5
 }
 
+// returns clutch attempts, clutch wins
+func computeClutches(rounds []Round) (ClutchMap, ClutchMap) {
+	attempts := make(ClutchMap)
+	wins := make(ClutchMap)
+
+	for _, round := range rounds {
+		clutch := round.Clutch
+		if clutch == nil {
+			continue
+		}
+
+		if attempts[clutch.Opponents] == nil {
+			attempts[clutch.Opponents] = make(PlayerIntMap)
+			wins[clutch.Opponents] = make(PlayerIntMap)
+		}
+
+		attempts[clutch.Opponents][clutch.Player] += 1
+		if clutch.Won {
+			wins[clutch.Opponents][clutch.Player] += 1
+		}
+	}
+
+	return attempts, wins
+}
+
+// returns accuracy, first bullet accuracy
+func computeAccuracy(
+	shotsFired PlayerIntMap,
+	shotsHit PlayerIntMap,
+	firstShotsFired PlayerIntMap,
+	firstShotsHit PlayerIntMap,
+) (PlayerF64Map, PlayerF64Map) {
+	accuracy := make(PlayerF64Map)
+	firstBulletAccuracy := make(PlayerF64Map)
+
+	for player, shots := range shotsFired {
+		accuracy[player] = math.Round((float64(shotsHit[player]) / float64(shots)) * 100)
+	}
+
+	for player, shots := range firstShotsFired {
+		firstBulletAccuracy[player] = math.Round((float64(firstShotsHit[player]) / float64(shots)) * 100)
+	}
+
+	return accuracy, firstBulletAccuracy
+}
+
+func computeWeaponAccuracy(weapons PlayerWeaponMap) PlayerWeaponMap {
+	for _, playerWeapons := range weapons {
+		for weapon, stats := range playerWeapons {
+			if stats.ShotsFired != 0 {
+				stats.Accuracy = math.Round((float64(stats.Hits) / float64(stats.ShotsFired)) * 100)
+			}
+			playerWeapons[weapon] = stats
+		}
+	}
+	return weapons
+}
+
 func computeEFPerFlash(flashesThrown PlayerIntMap, enemiesFlashed PlayerIntMap) PlayerF64Map {
 	ret := make(PlayerF64Map)
 	for player, f := range flashesThrown {
@@ -208,9 +287,63 @@ func computeEFPerFlash(flashesThrown PlayerIntMap, enemiesFlashed PlayerIntMap)
 	return ret
 }
 
-func computeStartSides(teams map[uint64]string, rounds []Round, halfLength int) map[uint64]string {
-	_, teamAStartSide := getScore(rounds, "CT", 1, halfLength)
-	_, teamBStartSide := getScore(rounds, "T", 1, halfLength)
+// Figures out the half length and overtime half length for the match. The
+// game rules are the most reliable source but the convars aren't always
+// networked, in which case we fall back to the rounds where the teams
+// actually switched sides, and finally to guessing from the score
+func computeMatchFormat(rules DemoRules, sideSwitches []bool, rounds []Round) (int, int) {
+	halfLength := rules.MaxRounds / 2
+	overtimeHalfLength := rules.OvertimeMaxRounds / 2
+
+	var switchRounds []int
+	for i, switched := range sideSwitches {
+		if switched {
+			switchRounds = append(switchRounds, i+1)
+		}
+	}
+
+	if halfLength == 0 && len(switchRounds) > 0 {
+		halfLength = switchRounds[0]
+	}
+
+	if halfLength == 0 {
+		halfLength = guessHalfLength(rounds)
+	}
+
+	if overtimeHalfLength == 0 {
+		for _, round := range switchRounds {
+			if round > halfLength*2 {
+				overtimeHalfLength = round - halfLength*2
+				break
+			}
+		}
+	}
+
+	if overtimeHalfLength == 0 {
+		overtimeHalfLength = DefaultOvertimeHalfLength
+	}
+
+	return halfLength, overtimeHalfLength
+}
+
+// Picks the first half length where either team managed to win the match
+// in regulation, or where the match went the full distance
+func guessHalfLength(rounds []Round) int {
+	for _, halfLength := range KnownHalfLengths {
+		teamAScore, _ := getScore(rounds, "CT", 999999999, halfLength, DefaultOvertimeHalfLength)
+		teamBScore, _ := getScore(rounds, "T", 999999999, halfLength, DefaultOvertimeHalfLength)
+
+		if teamAScore > halfLength || teamBScore > halfLength || len(rounds) >= halfLength*2 {
+			return halfLength
+		}
+	}
+
+	return KnownHalfLengths[0]
+}
+
+func computeStartSides(teams map[uint64]string, rounds []Round, halfLength, overtimeHalfLength int) map[uint64]string {
+	_, teamAStartSide := getScore(rounds, "CT", 1, halfLength, overtimeHalfLength)
+	_, teamBStartSide := getScore(rounds, "T", 1, halfLength, overtimeHalfLength)
 	ret := make(map[uint64]string)
 	for player, team := range teams {
 		if team == "CT" {
@@ -255,12 +388,12 @@ func computeOpenings(openingKills []OpeningKill) (
 	return oKills, oDeaths, oAttempts, oAttemptsPct, oSuccess
 }
 
-func computeRoundByRound(rounds []Round, killFeed KillFeed, halfLength int) []RoundOverview {
+func computeRoundByRound(rounds []Round, killFeed KillFeed, halfLength, overtimeHalfLength int) []RoundOverview {
 	var ret []RoundOverview
 	for i, k := range killFeed {
 		roundInfo := rounds[i]
-		teamAScore, teamASide := getScore(rounds, "CT", i+1, halfLength)
-		teamBScore, teamBSide := getScore(rounds, "T", i+1, halfLength)
+		teamAScore, teamASide := getScore(rounds, "CT", i+1, halfLength, overtimeHalfLength)
+		teamBScore, teamBSide := getScore(rounds, "T", i+1, halfLength, overtimeHalfLength)
 		var events []RoundEvent
 
 		for killer, k2 := range k {
@@ -308,9 +441,67 @@ func computeRoundByRound(rounds []Round, killFeed KillFeed, halfLength int) []Ro
 			TeamBScore: teamBScore,
 			TeamASide:  teamASide,
 			TeamBSide:  teamBSide,
+			Overtime:   computeRoundOvertime(rounds, i, halfLength, overtimeHalfLength),
 			Events:     events,
 		})
 	}
 
 	return ret
 }
+
+// Returns nil for rounds in regulation. The overtime scores only
+// count the rounds played in the current overtime
+func computeRoundOvertime(rounds []Round, round, halfLength, overtimeHalfLength int) *RoundOvertime {
+	if round < halfLength*2 || overtimeHalfLength <= 0 {
+		return nil
+	}
+
+	overtimeLength := overtimeHalfLength * 2
+	number := (round - halfLength*2) / overtimeLength
+	startRound := halfLength*2 + number*overtimeLength
+
+	teamAScore, _ := getScore(rounds, "CT", round+1, halfLength, overtimeHalfLength)
+	teamBScore, _ := getScore(rounds, "T", round+1, halfLength, overtimeHalfLength)
+	teamAStartScore, _ := getScore(rounds, "CT", startRound, halfLength, overtimeHalfLength)
+	teamBStartScore, _ := getScore(rounds, "T", startRound, halfLength, overtimeHalfLength)
+
+	return &RoundOvertime{
+		Number:     number + 1,
+		Round:      round - startRound + 1,
+		TeamAScore: teamAScore - teamAStartScore,
+		TeamBScore: teamBScore - teamBStartScore,
+	}
+}
+
+func classifyBuy(economy TeamEconomy, isPistol bool) string {
+	if isPistol {
+		return "pistol"
+	}
+
+	if economy.EquipmentValue < EcoMaxEquipment {
+		return "eco"
+	}
+
+	if economy.EquipmentValue >= FullBuyMinEquipment {
+		return "full"
+	}
+
+	if economy.StartMoney-economy.MoneySpent < ForceBuyMaxLeftover {
+		return "force"
+	}
+
+	return "half"
+}
+
+func computeEconomy(economy []RoundEconomy, halfLength int) []RoundEconomy {
+	ret := make([]RoundEconomy, len(economy))
+	for i, e := range economy {
+		// No pistol rounds in overtime, everyone starts with the same
+		// amount of money
+		isPistol := i == 0 || i == halfLength
+		ret[i] = e
+		ret[i].CT.BuyType = classifyBuy(e.CT, isPistol)
+		ret[i].T.BuyType = classifyBuy(e.T, isPistol)
+	}
+	return ret
+}
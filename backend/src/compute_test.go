@@ -0,0 +1,304 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassifyBuy(t *testing.T) {
+	tests := []struct {
+		name     string
+		economy  TeamEconomy
+		isPistol bool
+		want     string
+	}{
+		{"pistol round", TeamEconomy{EquipmentValue: 4000, MoneySpent: 3500, StartMoney: 4000}, true, "pistol"},
+		// A pistol round is still a pistol round with a lot of
+		// money (e.g. a league config with higher start money)
+		{"rich pistol round", TeamEconomy{EquipmentValue: 25000, MoneySpent: 20000, StartMoney: 50000}, true, "pistol"},
+		{"eco", TeamEconomy{EquipmentValue: 4500, MoneySpent: 500, StartMoney: 9000}, false, "eco"},
+		{"just over eco", TeamEconomy{EquipmentValue: EcoMaxEquipment, MoneySpent: 3000, StartMoney: 20000}, false, "half"},
+		{"full buy", TeamEconomy{EquipmentValue: FullBuyMinEquipment, MoneySpent: 18000, StartMoney: 30000}, false, "full"},
+		{"force buy", TeamEconomy{EquipmentValue: 12000, MoneySpent: 10000, StartMoney: 12000}, false, "force"},
+		{"half buy", TeamEconomy{EquipmentValue: 12000, MoneySpent: 9000, StartMoney: 12000 + ForceBuyMaxLeftover}, false, "half"},
+	}
+
+	for _, test := range tests {
+		if got := classifyBuy(test.economy, test.isPistol); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestComputeEconomyPistolRounds(t *testing.T) {
+	// Both teams full buy every round, so only the pistol
+	// rounds should be classified as anything else
+	fullBuy := TeamEconomy{EquipmentValue: 25000, MoneySpent: 20000, StartMoney: 40000}
+
+	tests := []struct {
+		halfLength int
+		numRounds  int
+		pistols    []int
+	}{
+		{15, 30, []int{0, 15}},
+		{12, 24, []int{0, 12}},
+		{8, 16, []int{0, 8}},
+		// No pistol rounds in overtime
+		{12, 30, []int{0, 12}},
+		// A match that ended before half time
+		{15, 10, []int{0}},
+	}
+
+	for _, test := range tests {
+		economy := make([]RoundEconomy, test.numRounds)
+		for i := range economy {
+			economy[i] = RoundEconomy{CT: fullBuy, T: fullBuy}
+		}
+
+		computed := computeEconomy(economy, test.halfLength)
+		if len(computed) != test.numRounds {
+			t.Fatalf("MR%d: got %d rounds, want %d", test.halfLength, len(computed), test.numRounds)
+		}
+
+		pistols := make(map[int]bool)
+		for _, round := range test.pistols {
+			pistols[round] = true
+		}
+
+		for i, round := range computed {
+			want := "full"
+			if pistols[i] {
+				want = "pistol"
+			}
+
+			if round.CT.BuyType != want || round.T.BuyType != want {
+				t.Errorf("MR%d round %d: got %q and %q, want %q", test.halfLength, i+1, round.CT.BuyType, round.T.BuyType, want)
+			}
+		}
+
+		if economy[0].CT.BuyType != "" {
+			t.Errorf("MR%d: the economy passed in was modified", test.halfLength)
+		}
+	}
+}
+
+// Only the players are needed for detecting clutches
+type testGameState struct {
+	DemoGameState
+	players []*DemoPlayer
+}
+
+func (gs testGameState) Playing() []*DemoPlayer {
+	return gs.players
+}
+
+// Players 1-5 are on CT and 6-10 are on T, with the same steam IDs
+func newTestGameState() (testGameState, map[uint64]*DemoPlayer) {
+	var gs testGameState
+	players := make(map[uint64]*DemoPlayer)
+	for i := 1; i <= 10; i++ {
+		side := "CT"
+		if i > 5 {
+			side = "T"
+		}
+
+		player := &DemoPlayer{EntityId: i, SteamID64: uint64(i), IsAlive: true, Side: side}
+		gs.players = append(gs.players, player)
+		players[player.SteamID64] = player
+	}
+	return gs, players
+}
+
+// Kills the players in order the same way the kill handler does, keeping
+// the first clutch that comes up. The victim is still alive as far as the
+// game state is concerned when the clutch is checked
+func killPlayers(gs testGameState, players map[uint64]*DemoPlayer, clutch *Clutch, victims ...uint64) *Clutch {
+	for _, victim := range victims {
+		if clutch == nil {
+			clutch = detectClutch(gs, players[victim])
+		}
+		players[victim].IsAlive = false
+	}
+	return clutch
+}
+
+func TestDetectClutch(t *testing.T) {
+	tests := []struct {
+		name    string
+		victims []uint64
+		want    *Clutch
+	}{
+		{"1v5", []uint64{1, 2, 3, 4}, &Clutch{Player: 5, Side: "CT", Opponents: 5}},
+		{"1v3", []uint64{6, 7, 1, 2, 3, 4}, &Clutch{Player: 5, Side: "CT", Opponents: 3}},
+		{"first player left alone", []uint64{1, 2, 3, 6, 7, 8, 9, 4}, &Clutch{Player: 10, Side: "T", Opponents: 2}},
+		{"T side 1v2", []uint64{6, 1, 7, 2, 8, 3, 9}, &Clutch{Player: 10, Side: "T", Opponents: 2}},
+		{"no clutch", []uint64{1, 6, 2, 7}, nil},
+	}
+
+	for _, test := range tests {
+		gs, players := newTestGameState()
+		got := killPlayers(gs, players, nil, test.victims...)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got clutch %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDetectClutchLastKill(t *testing.T) {
+	// The last kill of a 1v1 doesn't start a new clutch
+	gs, players := newTestGameState()
+	killPlayers(gs, players, nil, 1, 2, 3, 4, 6, 7, 8, 9)
+	if clutch := detectClutch(gs, players[5]); clutch != nil {
+		t.Errorf("got clutch %+v from the last kill of the round", clutch)
+	}
+}
+
+func TestClutchDiedAfterRoundEnd(t *testing.T) {
+	gs, players := newTestGameState()
+
+	// Player 5 is left in a 1v3, kills one of them and defuses the bomb
+	clutch := killPlayers(gs, players, nil, 6, 7, 1, 2, 3, 4, 8)
+
+	// Same as the round end handler
+	clutch.Won = clutch.Side == "CT"
+	round := Round{Winner: "CT", Clutch: clutch}
+
+	// Then gets killed by one of the Ts after the round is over
+	clutch = killPlayers(gs, players, clutch, 5)
+
+	want := &Clutch{Player: 5, Side: "CT", Opponents: 3, Won: true}
+	if !reflect.DeepEqual(round.Clutch, want) || clutch != round.Clutch {
+		t.Errorf("got clutch %+v, want %+v", round.Clutch, want)
+	}
+
+	attempts, wins := computeClutches([]Round{round, {Winner: "T"}})
+	if attempts[3][5] != 1 || wins[3][5] != 1 {
+		t.Errorf("got %d attempts and %d wins of 1v3, want 1 and 1", attempts[3][5], wins[3][5])
+	}
+
+	if len(attempts) != 1 || len(wins) != 1 {
+		t.Errorf("got clutches %v and wins %v, want only the 1v3", attempts, wins)
+	}
+}
+
+// Builds the rounds of a match from which team won each of them. Team A
+// starts on T and switches to CT at half time
+func newTestMatchRounds(halfLength int, winners string) []Round {
+	rounds := make([]Round, len(winners))
+	for i, winner := range winners {
+		teamASide, teamBSide := "T", "CT"
+		if i >= halfLength {
+			teamASide, teamBSide = "CT", "T"
+		}
+
+		if winner == 'A' {
+			rounds[i].Winner = teamASide
+		} else {
+			rounds[i].Winner = teamBSide
+		}
+	}
+	return rounds
+}
+
+func TestComputeMatchFormat(t *testing.T) {
+	tests := []struct {
+		name         string
+		rules        DemoRules
+		sideSwitches []int
+		rounds       []Round
+		halfLength   int
+		overtime     int
+	}{
+		{
+			name:       "from the game rules",
+			rules:      DemoRules{MaxRounds: 24, OvertimeMaxRounds: 10},
+			rounds:     newTestMatchRounds(15, strings.Repeat("AB", 13)),
+			halfLength: 12,
+			overtime:   5,
+		},
+		{
+			name:         "from the side switches",
+			sideSwitches: []int{12, 27},
+			rounds:       newTestMatchRounds(12, strings.Repeat("AB", 15)),
+			halfLength:   12,
+			overtime:     3,
+		},
+		{
+			name:         "from the side switches with MR5 overtime",
+			sideSwitches: []int{15, 35},
+			rounds:       newTestMatchRounds(15, strings.Repeat("AB", 20)),
+			halfLength:   15,
+			overtime:     5,
+		},
+		// Without mp_maxrounds or any side switches the half length is
+		// guessed from the score
+		{
+			name:       "MR15 win",
+			rounds:     newTestMatchRounds(15, strings.Repeat("A", 16)+strings.Repeat("B", 10)),
+			halfLength: 15,
+			overtime:   DefaultOvertimeHalfLength,
+		},
+		{
+			name:       "MR15 draw",
+			rounds:     newTestMatchRounds(15, strings.Repeat("AB", 15)),
+			halfLength: 15,
+			overtime:   DefaultOvertimeHalfLength,
+		},
+		{
+			name:       "MR12 win",
+			rounds:     newTestMatchRounds(12, strings.Repeat("AAB", 5)+strings.Repeat("A", 3)),
+			halfLength: 12,
+			overtime:   DefaultOvertimeHalfLength,
+		},
+		{
+			name:       "MR12 loss",
+			rounds:     newTestMatchRounds(12, strings.Repeat("ABB", 6)+"B"),
+			halfLength: 12,
+			overtime:   DefaultOvertimeHalfLength,
+		},
+		{
+			name:       "MR8 win",
+			rounds:     newTestMatchRounds(8, strings.Repeat("AAB", 4)+"A"),
+			halfLength: 8,
+			overtime:   DefaultOvertimeHalfLength,
+		},
+		{
+			name:       "abandoned early",
+			rounds:     newTestMatchRounds(15, "AABAB"),
+			halfLength: KnownHalfLengths[0],
+			overtime:   DefaultOvertimeHalfLength,
+		},
+	}
+
+	for _, test := range tests {
+		sideSwitches := make([]bool, len(test.rounds))
+		for _, round := range test.sideSwitches {
+			sideSwitches[round-1] = true
+		}
+
+		halfLength, overtime := computeMatchFormat(test.rules, sideSwitches, test.rounds)
+		if halfLength != test.halfLength || overtime != test.overtime {
+			t.Errorf("%s: got half length %d and overtime %d, want %d and %d", test.name, halfLength, overtime, test.halfLength, test.overtime)
+		}
+	}
+}
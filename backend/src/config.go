@@ -28,25 +28,47 @@ import (
 )
 
 type Config struct {
-	allowDemoDownload bool
-	assetsPath        string
-	dataPath          string
-	dbConnString      string
-	dbType            string
-	debug             bool
-	demosPath         string
-	frontendPath      string
-	jwtSecret         []byte
-	jwtSessionHours   int
-	matchVisibility   string
-	migrationsPath    string
-	port              string
-	rescanInterval    int
-	selfSignupEnabled bool
-	showLoginButton   bool
-	staticPath        string
-	timezone          string
-	trustedProxies    []string
+	allowDemoDownload  bool
+	assetsPath         string
+	autoMergeDemos     bool
+	dataPath           string
+	dbConnString       string
+	dbType             string
+	debug              bool
+	demoDateSources    []string
+	demoRoots          []DemoRoot
+	demoStore          string
+	demoTypeRules      []DemoTypeRule
+	frontendPath       string
+	importMaxSize      int
+	jwtSecret          []byte
+	jwtSessionHours    int
+	matchVisibility    string
+	migrationsPath     string
+	parseMaxAttempts   int
+	parseRetryBackoff  int
+	parseWorkers       int
+	port               string
+	recoverPartial     bool
+	removedDemoAction  string
+	replaySampleRate   int
+	rescanInterval     int
+	s3AccessKey        string
+	s3Bucket           string
+	s3Endpoint         string
+	s3PathStyle        bool
+	s3PresignDownloads bool
+	s3Region           string
+	s3SecretKey        string
+	selfSignupEnabled  bool
+	showLoginButton    bool
+	staticPath         string
+	timezone           string
+	trustedProxies     []string
+	uploadMaxSize      int
+	uploadPath         string
+	watchMode          string
+	watchPollInterval  int
 }
 
 // FOR DEVELOPERS: Make sure you update the configuration documentation when adding
@@ -76,6 +98,26 @@ func getConfig() (Config, error) {
 		return Config{}, err
 	}
 
+	replaySampleRate, err := envOrNumber("PUGGIES_REPLAY_SAMPLE_RATE", 4)
+	if err != nil {
+		return Config{}, err
+	}
+
+	parseWorkers, err := envOrNumber("PUGGIES_PARSE_WORKERS", 2)
+	if err != nil {
+		return Config{}, err
+	}
+
+	parseMaxAttempts, err := envOrNumber("PUGGIES_PARSE_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return Config{}, err
+	}
+
+	parseRetryBackoff, err := envOrNumber("PUGGIES_PARSE_RETRY_BACKOFF_MINUTES", 60)
+	if err != nil {
+		return Config{}, err
+	}
+
 	jwtSessionHours, err := envOrNumber("PUGGIES_JWT_SESSION_LENGTH_HOURS", 336)
 	if err != nil {
 		return Config{}, err
@@ -86,26 +128,117 @@ func getConfig() (Config, error) {
 		return Config{}, err
 	}
 
+	removedDemoAction, err := removedDemoAction()
+	if err != nil {
+		return Config{}, err
+	}
+
+	importMaxSize, err := envOrNumber("PUGGIES_IMPORT_MAX_SIZE_MB", 1024)
+	if err != nil {
+		return Config{}, err
+	}
+
+	uploadMaxSize, err := envOrNumber("PUGGIES_UPLOAD_MAX_SIZE_MB", 1024)
+	if err != nil {
+		return Config{}, err
+	}
+
+	watchMode, err := watchMode()
+	if err != nil {
+		return Config{}, err
+	}
+
+	watchPollInterval, err := envOrNumber("PUGGIES_WATCH_POLL_INTERVAL_SECONDS", 10)
+	if err != nil {
+		return Config{}, err
+	}
+
+	demoRoots, err := demoRoots()
+	if err != nil {
+		return Config{}, err
+	}
+
+	demoTypeRules, err := demoTypeRules()
+	if err != nil {
+		return Config{}, err
+	}
+
+	uploadPath, err := uploadPath(demoRoots)
+	if err != nil {
+		return Config{}, err
+	}
+
+	demoStore, err := demoStore()
+	if err != nil {
+		return Config{}, err
+	}
+
+	// The bucket and credentials are only needed when using S3
+	s3Bucket, s3AccessKey, s3SecretKey := "", "", ""
+	if demoStore == "s3" {
+		s3Bucket, err = envStringRequired("PUGGIES_S3_BUCKET")
+		if err != nil {
+			return Config{}, err
+		}
+
+		s3AccessKey, err = envStringRequired("PUGGIES_S3_ACCESS_KEY")
+		if err != nil {
+			return Config{}, err
+		}
+
+		s3SecretKey, err = envStringRequired("PUGGIES_S3_SECRET_KEY")
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	demoDateSources, err := demoDateSources()
+	if err != nil {
+		return Config{}, err
+	}
+
 	return Config{
-		allowDemoDownload: envOrBool("PUGGIES_ALLOW_DEMO_DOWNLOAD", true),
-		assetsPath:        envOrString("PUGGIES_ASSETS_PATH", "/backend/assets"),
-		dataPath:          envOrString("PUGGIES_DATA_PATH", "/data"),
-		dbConnString:      dbConnString,
-		dbType:            dbType,
-		debug:             envOrBool("PUGGIES_DEBUG", false),
-		demosPath:         envOrString("PUGGIES_DEMOS_PATH", "/demos"),
-		frontendPath:      envOrString("PUGGIES_FRONTEND_PATH", "/app"),
-		jwtSecret:         []byte(jwtSecret),
-		jwtSessionHours:   jwtSessionHours,
-		matchVisibility:   matchVisibility,
-		migrationsPath:    envOrString("PUGGIES_MIGRATIONS_PATH", "/backend/migrations"),
-		port:              envOrString("PUGGIES_HTTP_PORT", "9115"),
-		rescanInterval:    rescanInterval,
-		selfSignupEnabled: envOrBool("PUGGIES_ALLOW_SELF_SIGNUP", false),
-		showLoginButton:   envOrBool("PUGGIES_SHOW_LOGIN_BUTTON", true),
-		staticPath:        envOrString("PUGGIES_STATIC_PATH", "/frontend/build"),
-		timezone:          envOrString("PUGGIES_TZ", "Etc/UTC"),
-		trustedProxies:    envStringList("PUGGIES_TRUSTED_PROXIES"),
+		allowDemoDownload:  envOrBool("PUGGIES_ALLOW_DEMO_DOWNLOAD", true),
+		assetsPath:         envOrString("PUGGIES_ASSETS_PATH", "/backend/assets"),
+		autoMergeDemos:     envOrBool("PUGGIES_AUTO_MERGE_DEMOS", false),
+		dataPath:           envOrString("PUGGIES_DATA_PATH", "/data"),
+		dbConnString:       dbConnString,
+		dbType:             dbType,
+		debug:              envOrBool("PUGGIES_DEBUG", false),
+		demoDateSources:    demoDateSources,
+		demoRoots:          demoRoots,
+		demoStore:          demoStore,
+		demoTypeRules:      demoTypeRules,
+		frontendPath:       envOrString("PUGGIES_FRONTEND_PATH", "/app"),
+		importMaxSize:      importMaxSize,
+		jwtSecret:          []byte(jwtSecret),
+		jwtSessionHours:    jwtSessionHours,
+		matchVisibility:    matchVisibility,
+		migrationsPath:     envOrString("PUGGIES_MIGRATIONS_PATH", "/backend/migrations"),
+		parseMaxAttempts:   parseMaxAttempts,
+		parseRetryBackoff:  parseRetryBackoff,
+		parseWorkers:       parseWorkers,
+		port:               envOrString("PUGGIES_HTTP_PORT", "9115"),
+		recoverPartial:     envOrBool("PUGGIES_RECOVER_PARTIAL_DEMOS", false),
+		removedDemoAction:  removedDemoAction,
+		replaySampleRate:   replaySampleRate,
+		rescanInterval:     rescanInterval,
+		s3AccessKey:        s3AccessKey,
+		s3Bucket:           s3Bucket,
+		s3Endpoint:         envOrString("PUGGIES_S3_ENDPOINT", ""),
+		s3PathStyle:        envOrBool("PUGGIES_S3_PATH_STYLE", true),
+		s3PresignDownloads: envOrBool("PUGGIES_S3_PRESIGN_DOWNLOADS", true),
+		s3Region:           envOrString("PUGGIES_S3_REGION", "us-east-1"),
+		s3SecretKey:        s3SecretKey,
+		selfSignupEnabled:  envOrBool("PUGGIES_ALLOW_SELF_SIGNUP", false),
+		showLoginButton:    envOrBool("PUGGIES_SHOW_LOGIN_BUTTON", true),
+		staticPath:         envOrString("PUGGIES_STATIC_PATH", "/frontend/build"),
+		timezone:           envOrString("PUGGIES_TZ", "Etc/UTC"),
+		trustedProxies:     envStringList("PUGGIES_TRUSTED_PROXIES"),
+		uploadMaxSize:      uploadMaxSize,
+		uploadPath:         uploadPath,
+		watchMode:          watchMode,
+		watchPollInterval:  watchPollInterval,
 	}, nil
 }
 
@@ -113,23 +246,45 @@ func (config Config) String() string {
 	ret := "\n{\n"
 	ret += "\t" + "allowDemoDownload: " + strconv.FormatBool(config.allowDemoDownload) + "\n"
 	ret += "\t" + "assetsPath: " + config.assetsPath + "\n"
+	ret += "\t" + "autoMergeDemos: " + strconv.FormatBool(config.autoMergeDemos) + "\n"
 	ret += "\t" + "dataPath: " + config.dataPath + "\n"
 	ret += "\t" + "dbConnString: [redacted]\n"
 	ret += "\t" + "dbType: " + config.dbType + "\n"
 	ret += "\t" + "debug: " + strconv.FormatBool(config.debug) + "\n"
-	ret += "\t" + "demosPath: " + config.demosPath + "\n"
+	ret += "\t" + "demoDateSources: " + strings.Join(config.demoDateSources, ", ") + "\n"
+	ret += "\t" + "demoRoots: " + demoRootsString(config.demoRoots) + "\n"
+	ret += "\t" + "demoStore: " + config.demoStore + "\n"
+	ret += "\t" + "demoTypeRules: " + demoTypeRulesString(config.demoTypeRules) + "\n"
 	ret += "\t" + "frontendPath: " + config.frontendPath + "\n"
+	ret += "\t" + "importMaxSize: " + strconv.Itoa(config.importMaxSize) + "\n"
 	ret += "\t" + "jwtSecret: [redacted]\n"
 	ret += "\t" + "jwtSessionHours: " + strconv.Itoa(config.jwtSessionHours) + "\n"
 	ret += "\t" + "matchVisibility: " + config.matchVisibility + "\n"
 	ret += "\t" + "migrationsPath: " + config.migrationsPath + "\n"
+	ret += "\t" + "parseMaxAttempts: " + strconv.Itoa(config.parseMaxAttempts) + "\n"
+	ret += "\t" + "parseRetryBackoff: " + strconv.Itoa(config.parseRetryBackoff) + "\n"
+	ret += "\t" + "parseWorkers: " + strconv.Itoa(config.parseWorkers) + "\n"
 	ret += "\t" + "port: " + config.port + "\n"
+	ret += "\t" + "recoverPartial: " + strconv.FormatBool(config.recoverPartial) + "\n"
+	ret += "\t" + "removedDemoAction: " + config.removedDemoAction + "\n"
+	ret += "\t" + "replaySampleRate: " + strconv.Itoa(config.replaySampleRate) + "\n"
 	ret += "\t" + "rescanInterval: " + strconv.Itoa(config.rescanInterval) + "\n"
+	ret += "\t" + "s3AccessKey: [redacted]\n"
+	ret += "\t" + "s3Bucket: " + config.s3Bucket + "\n"
+	ret += "\t" + "s3Endpoint: " + config.s3Endpoint + "\n"
+	ret += "\t" + "s3PathStyle: " + strconv.FormatBool(config.s3PathStyle) + "\n"
+	ret += "\t" + "s3PresignDownloads: " + strconv.FormatBool(config.s3PresignDownloads) + "\n"
+	ret += "\t" + "s3Region: " + config.s3Region + "\n"
+	ret += "\t" + "s3SecretKey: [redacted]\n"
 	ret += "\t" + "selfSignupEnabled: " + strconv.FormatBool(config.selfSignupEnabled) + "\n"
 	ret += "\t" + "showLoginButton: " + strconv.FormatBool(config.showLoginButton) + "\n"
 	ret += "\t" + "staticPath: " + config.staticPath + "\n"
 	ret += "\t" + "timezone: " + config.timezone + "\n"
 	ret += "\t" + "trustedProxies: " + strings.Join(config.trustedProxies, ", ") + "\n"
+	ret += "\t" + "uploadMaxSize: " + strconv.Itoa(config.uploadMaxSize) + "\n"
+	ret += "\t" + "uploadPath: " + config.uploadPath + "\n"
+	ret += "\t" + "watchMode: " + config.watchMode + "\n"
+	ret += "\t" + "watchPollInterval: " + strconv.Itoa(config.watchPollInterval) + "\n"
 	ret += "}"
 	return ret
 }
@@ -200,3 +355,172 @@ func matchVisibility() (string, error) {
 
 	return val, nil
 }
+
+func removedDemoAction() (string, error) {
+	val := envOrString("PUGGIES_REMOVED_DEMO_ACTION", "flag")
+	if val != "flag" && val != "delete" {
+		return "", errors.New(
+			fmt.Sprintf(
+				"[warn] invalid value \"%s\" provided for variable %s. Options are %s or %s",
+				val,
+				"PUGGIES_REMOVED_DEMO_ACTION",
+				"flag",
+				"delete",
+			),
+		)
+	}
+
+	return val, nil
+}
+
+func demoStore() (string, error) {
+	val := envOrString("PUGGIES_DEMO_STORE", "local")
+	if val != "local" && val != "s3" {
+		return "", errors.New(
+			fmt.Sprintf(
+				"[warn] invalid value \"%s\" provided for variable %s. Options are %s or %s",
+				val,
+				"PUGGIES_DEMO_STORE",
+				"local",
+				"s3",
+			),
+		)
+	}
+
+	return val, nil
+}
+
+func watchMode() (string, error) {
+	val := envOrString("PUGGIES_WATCH_MODE", "notify")
+	if val != "notify" && val != "poll" {
+		return "", errors.New(
+			fmt.Sprintf(
+				"[warn] invalid value \"%s\" provided for variable %s. Options are %s or %s",
+				val,
+				"PUGGIES_WATCH_MODE",
+				"notify",
+				"poll",
+			),
+		)
+	}
+
+	return val, nil
+}
+
+func demoRoots() ([]DemoRoot, error) {
+	val := envOrString("PUGGIES_DEMOS_PATH", "/demos")
+	roots := make([]DemoRoot, 0)
+
+	invalid := func(entry, reason string) error {
+		return errors.New(
+			fmt.Sprintf(
+				"[warn] invalid demo folder \"%s\" provided for variable %s: %s",
+				entry,
+				"PUGGIES_DEMOS_PATH",
+				reason,
+			),
+		)
+	}
+
+	for _, entry := range strings.Split(val, ",") {
+		options := strings.Split(entry, ";")
+		root := DemoRoot{path: normalizeFolderPath(options[0]), tags: []string{}}
+		if root.path == "" {
+			return nil, invalid(entry, "the path can not be empty")
+		}
+
+		for _, option := range options[1:] {
+			parts := strings.SplitN(option, "=", 2)
+			if len(parts) != 2 {
+				return nil, invalid(entry, "options must be in the form name=value")
+			}
+
+			switch parts[0] {
+			case "type":
+				if !isDemoType(parts[1]) {
+					return nil, invalid(entry, "type must be one of "+strings.Join(DemoTypes, ", "))
+				}
+				root.demoType = parts[1]
+			case "tags":
+				root.tags = strings.Split(parts[1], "|")
+			default:
+				return nil, invalid(entry, "unknown option "+parts[0])
+			}
+		}
+
+		for _, other := range roots {
+			if other.path == root.path {
+				return nil, invalid(entry, "the folder is already listed")
+			}
+		}
+
+		roots = append(roots, root)
+	}
+
+	return roots, nil
+}
+
+// Uploaded demos have to end up somewhere that the demo index
+// and the watcher know about, so the upload folder has to be
+// one of the demo folders or inside of one
+func uploadPath(roots []DemoRoot) (string, error) {
+	val := normalizeFolderPath(envOrString("PUGGIES_UPLOAD_PATH", roots[0].path))
+
+	for _, root := range roots {
+		if val == root.path || strings.HasPrefix(val, root.path+"/") {
+			return val, nil
+		}
+	}
+
+	return "", errors.New(
+		fmt.Sprintf(
+			"[warn] invalid value \"%s\" provided for variable %s. The upload folder must be inside one of the demo folders",
+			val,
+			"PUGGIES_UPLOAD_PATH",
+		),
+	)
+}
+
+func demoTypeRules() ([]DemoTypeRule, error) {
+	val := envOrString("PUGGIES_DEMO_TYPE_RULES", "esea:esea,pug_:pugsetup,1-:faceit")
+	rules := make([]DemoTypeRule, 0)
+
+	for _, entry := range strings.Split(val, ",") {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || !isDemoType(parts[1]) {
+			return nil, errors.New(
+				fmt.Sprintf(
+					"[warn] invalid rule \"%s\" provided for variable %s. Rules must be in the form prefix:type where type is one of %s",
+					entry,
+					"PUGGIES_DEMO_TYPE_RULES",
+					strings.Join(DemoTypes, ", "),
+				),
+			)
+		}
+
+		rules = append(rules, DemoTypeRule{prefix: parts[0], demoType: parts[1]})
+	}
+
+	return rules, nil
+}
+
+func demoDateSources() ([]string, error) {
+	val := envOrString("PUGGIES_DEMO_DATE_SOURCES", "filename,mtime")
+	sources := strings.Split(val, ",")
+
+	for _, source := range sources {
+		if source != DateSourceMtime && source != DateSourceFileName {
+			return nil, errors.New(
+				fmt.Sprintf(
+					"[warn] invalid source \"%s\" provided for variable %s. Options are %s or %s",
+					source,
+					"PUGGIES_DEMO_DATE_SOURCES",
+					DateSourceMtime,
+					DateSourceFileName,
+				),
+			)
+		}
+	}
+
+	return sources, nil
+}
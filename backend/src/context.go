@@ -21,9 +21,13 @@ package main
 
 // Everthing in here needs to be concurrency-safe
 type Context struct {
-	config Config
-	db     Storage
-	logger *Logger
+	config      Config
+	db          Storage
+	logger      *Logger
+	coordinator *ParseCoordinator
+	store       DemoStore
+	demos       *DemoIndex
+	uploads     *UploadTracker
 }
 
 func getContext(config Config, logger *Logger) (Context, error) {
@@ -38,9 +42,18 @@ func getContext(config Config, logger *Logger) (Context, error) {
 		db = pg
 	}
 
+	store, err := newDemoStore(config)
+	if err != nil {
+		return Context{}, err
+	}
+
 	return Context{
-		config: config,
-		db:     db,
-		logger: logger,
+		config:      config,
+		db:          db,
+		logger:      logger,
+		coordinator: newParseCoordinator(),
+		store:       store,
+		demos:       newDemoIndex(config.demoRoots, store),
+		uploads:     newUploadTracker(),
 	}, nil
 }
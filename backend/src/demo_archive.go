@@ -0,0 +1,168 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// The kinds of demo files that are picked up from the demos folder. Longer
+// extensions come first so that ".dem.gz" isn't mistaken for ".dem"
+var DemoExtensions = []string{".dem.bz2", ".dem.gz", ".zip", ".dem"}
+
+var ErrNoDemoInArchive = errors.New("archive does not contain a .dem file")
+
+func isDemoFile(path string) bool {
+	for _, ext := range DemoExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Closes the decompressor (if it needs closing) along with the file underneath
+type demoReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d demoReadCloser) Close() error {
+	var err error
+	for _, closer := range d.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Opens the demo for reading, decompressing it on the fly if it's
+// compressed or inside of an archive. Only the first .dem file in
+// a zip archive is read
+func openDemo(store DemoStore, path string) (io.ReadCloser, error) {
+	return openDemoNamed(store, path, path)
+}
+
+// Same as openDemo but the format is taken from the given file name
+// rather than the path (e.g. for uploads that are still in a temp file)
+func openDemoNamed(store DemoStore, path, fileName string) (io.ReadCloser, error) {
+	f, err := store.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(fileName, ".zip"):
+		return openZipDemo(f)
+	case strings.HasSuffix(fileName, ".dem.gz"):
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return demoReadCloser{Reader: r, closers: []io.Closer{r, f}}, nil
+	case strings.HasSuffix(fileName, ".dem.bz2"):
+		return demoReadCloser{Reader: bzip2.NewReader(f), closers: []io.Closer{f}}, nil
+	}
+
+	return f, nil
+}
+
+// Zip archives can't be read front to back since the list of files is at
+// the end, so archives that aren't local files are copied to a temp file
+func openZipDemo(f io.ReadCloser) (io.ReadCloser, error) {
+	file, ok := f.(*os.File)
+	if !ok {
+		tmp, err := os.CreateTemp("", "puggies-*.zip")
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		// The file stays readable until it's closed, and this
+		// way it can't be left behind if something goes wrong
+		os.Remove(tmp.Name())
+
+		_, err = io.Copy(tmp, f)
+		f.Close()
+		if err != nil {
+			tmp.Close()
+			return nil, err
+		}
+		file = tmp
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	for _, entry := range archive.File {
+		if !strings.HasSuffix(entry.Name, ".dem") {
+			continue
+		}
+
+		r, err := entry.Open()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		return demoReadCloser{Reader: r, closers: []io.Closer{r, file}}, nil
+	}
+
+	file.Close()
+	return nil, ErrNoDemoInArchive
+}
+
+// Hex encoded sha256 of the demo's contents. Compressed demos are hashed
+// after decompressing them so that the same demo is recognized no matter
+// which format it's stored in
+func hashDemo(store DemoStore, path string) (string, error) {
+	r, err := openDemo(store, path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
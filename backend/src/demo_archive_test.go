@@ -0,0 +1,204 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testDemo = "HL2DEMO\x00test demo"
+
+// testDemo compressed with bzip2, which the standard library can't do
+const testDemoBz2 = "425a68393141592653599a542f94000002dd80400040001000064686028c002000314c0001434d3341a3975fd811122af84e0bb9229c28484d2a17ca00"
+
+// Hands out readers that aren't *os.File, the same as a remote store would
+type streamingDemoStore struct {
+	LocalDemoStore
+}
+
+func (streamingDemoStore) Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ io.ReadCloser }{f}, nil
+}
+
+func writeTestZip(t *testing.T, path string, files map[string]string, order []string) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range order {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	zw.Close()
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Writes the same demo in each of the supported formats
+func writeTestDemos(t *testing.T) map[string]string {
+	dir := t.TempDir()
+	paths := map[string]string{
+		"dem":  filepath.Join(dir, "pug_de_train.dem"),
+		"gz":   filepath.Join(dir, "pug_de_train.dem.gz"),
+		"bz2":  filepath.Join(dir, "pug_de_train.dem.bz2"),
+		"zip":  filepath.Join(dir, "pug_de_train.zip"),
+		"none": filepath.Join(dir, "screenshots.zip"),
+	}
+
+	if err := os.WriteFile(paths["dem"], []byte(testDemo), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(testDemo))
+	gw.Close()
+	if err := os.WriteFile(paths["gz"], gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bz2, _ := hex.DecodeString(testDemoBz2)
+	if err := os.WriteFile(paths["bz2"], bz2, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the demo should be read out of the archive
+	writeTestZip(t, paths["zip"], map[string]string{
+		"readme.txt":             "gg",
+		"demos/pug_de_train.dem": testDemo,
+		"pug_de_train_2.dem":     "HL2DEMO\x00second demo",
+	}, []string{"readme.txt", "demos/pug_de_train.dem", "pug_de_train_2.dem"})
+
+	writeTestZip(t, paths["none"], map[string]string{"screenshot.png": "png"}, []string{"screenshot.png"})
+
+	return paths
+}
+
+func TestOpenDemo(t *testing.T) {
+	paths := writeTestDemos(t)
+
+	for _, store := range []DemoStore{LocalDemoStore{}, streamingDemoStore{}} {
+		for _, format := range []string{"dem", "gz", "bz2", "zip"} {
+			r, err := openDemo(store, paths[format])
+			if err != nil {
+				t.Fatalf("%T %s: %v", store, format, err)
+			}
+
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%T %s: %v", store, format, err)
+			}
+
+			if err := r.Close(); err != nil {
+				t.Errorf("%T %s: close: %v", store, format, err)
+			}
+
+			if string(data) != testDemo {
+				t.Errorf("%T %s: got %q, want %q", store, format, data, testDemo)
+			}
+		}
+
+		_, err := openDemo(store, paths["none"])
+		if err != ErrNoDemoInArchive {
+			t.Errorf("%T: archive without a demo returned %v, want %v", store, err, ErrNoDemoInArchive)
+		}
+	}
+}
+
+func TestOpenDemoNamed(t *testing.T) {
+	paths := writeTestDemos(t)
+
+	// Uploads are kept in a temp file without the real extension
+	tempPath := filepath.Join(filepath.Dir(paths["gz"]), ".upload")
+	if err := os.Rename(paths["gz"], tempPath); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := openDemoNamed(LocalDemoStore{}, tempPath, "pug_de_train.dem.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	data, _ := io.ReadAll(r)
+	if string(data) != testDemo {
+		t.Errorf("got %q, want %q", data, testDemo)
+	}
+}
+
+func TestHashDemo(t *testing.T) {
+	paths := writeTestDemos(t)
+
+	want, err := hashDemo(LocalDemoStore{}, paths["dem"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same demo is recognized no matter how it's compressed
+	for _, format := range []string{"gz", "bz2", "zip"} {
+		got, err := hashDemo(LocalDemoStore{}, paths[format])
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if got != want {
+			t.Errorf("%s: got hash %s, want %s", format, got, want)
+		}
+	}
+}
+
+func TestDemoFileNames(t *testing.T) {
+	tests := []struct {
+		path   string
+		isDemo bool
+		id     string
+	}{
+		{"/demos/pug_de_train.dem", true, "pug_de_train"},
+		{"/demos/pug_de_train.dem.gz", true, "pug_de_train"},
+		{"/demos/pug_de_train.dem.bz2", true, "pug_de_train"},
+		{"/demos/pug_de_train.zip", true, "pug_de_train"},
+		{"/demos/pug_de_train.gz", false, "pug_de_train.gz"},
+		{"/demos/notes.txt", false, "notes.txt"},
+	}
+
+	for _, test := range tests {
+		if got := isDemoFile(test.path); got != test.isDemo {
+			t.Errorf("isDemoFile(%s) = %v, want %v", test.path, got, test.isDemo)
+		}
+
+		if got := getDemoFileName(test.path); got != test.id {
+			t.Errorf("getDemoFileName(%s) = %s, want %s", test.path, got, test.id)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// The parser backends translate the events from whichever demo library
+// they wrap into the types below so that parseDemo doesn't need to care
+// whether it's looking at a CS:GO or a CS2 demo. The CS:GO library's
+// equipment enum is used as our canonical weapon type since the weapon
+// asset names and the stored stats are already keyed off of it
+
+const (
+	DemoFormatCSGO = "csgo"
+	DemoFormatCS2  = "cs2"
+)
+
+var (
+	CSGODemoMagic = []byte("HL2DEMO\x00")
+	CS2DemoMagic  = []byte("PBDEMS2\x00")
+)
+
+var ErrUnknownDemoFormat = errors.New("unrecognized demo file header")
+
+type DemoBackend interface {
+	ParseHeader() (DemoHeader, error)
+	RegisterEventHandler(handler interface{})
+	ParseToEnd() error
+	CurrentTime() time.Duration
+	GameState() DemoGameState
+	Close()
+}
+
+type DemoGameState interface {
+	// All of the players known to the demo, including spectators
+	Participants() []*DemoPlayer
+	// Only the players who are on CT or T
+	Playing() []*DemoPlayer
+	// Returns nil if the side isn't "CT" or "T"
+	Team(side string) *DemoTeam
+	GrenadeProjectiles() []DemoProjectile
+	BombPosition() r3.Vector
+	Rules() DemoRules
+}
+
+type DemoHeader struct {
+	MapName    string
+	ServerName string
+	// Usually "GOTV Demo" for server-side recordings
+	ClientName   string
+	PlaybackTime time.Duration
+	Radar        MapRadar
+}
+
+// Any of the values may be zero if the
+// server didn't network the convar
+type DemoRules struct {
+	MaxRounds         int
+	OvertimeMaxRounds int
+}
+
+// The offset and scale used to translate in-game coordinates
+// into pixel coordinates on the map's radar overview
+type MapRadar struct {
+	PZero r2.Point
+	Scale float64
+}
+
+func (m MapRadar) TranslateScale(x, y float64) (float64, float64) {
+	return (x - m.PZero.X) / m.Scale, (m.PZero.Y - y) / m.Scale
+}
+
+// A snapshot of a player at the time the event was emitted
+type DemoPlayer struct {
+	EntityId            int
+	SteamID64           uint64
+	Name                string
+	IsBot               bool
+	IsConnected         bool
+	IsAlive             bool
+	Side                string
+	Position            r3.Vector
+	ViewDirectionX      float32
+	Health              int
+	Money               int
+	MoneySpentThisRound int
+	ActiveWeapon        *DemoWeapon
+	LastPlaceName       string
+}
+
+type DemoWeapon struct {
+	Type           common.EquipmentType
+	OriginalString string
+}
+
+type DemoTeam struct {
+	ClanName                    string
+	Score                       int
+	FreezeTimeEndEquipmentValue int
+	MoneySpentThisRound         int
+	Members                     []*DemoPlayer
+}
+
+type DemoProjectile struct {
+	EntityId int
+	Type     common.EquipmentType
+	Thrower  *DemoPlayer
+	Position r3.Vector
+}
+
+type HitGroup int
+
+const (
+	HitGroupGeneric HitGroup = iota
+	HitGroupHead
+	HitGroupChest
+	HitGroupStomach
+	HitGroupArm
+	HitGroupLeg
+	HitGroupOther
+)
+
+type BombEventKind string
+
+const (
+	BombPlantBegin  BombEventKind = "bomb_plant_begin"
+	BombPlanted     BombEventKind = "bomb_planted"
+	BombDefuseBegin BombEventKind = "bomb_defuse_begin"
+	BombDefused     BombEventKind = "bomb_defused"
+	BombExplode     BombEventKind = "bomb_explode"
+)
+
+type GrenadeEventKind string
+
+const (
+	GrenadeHeExplode    GrenadeEventKind = "he_explode"
+	GrenadeFlashExplode GrenadeEventKind = "flash_explode"
+	GrenadeSmokeStart   GrenadeEventKind = "smoke_start"
+	GrenadeSmokeExpire  GrenadeEventKind = "smoke_expire"
+	GrenadeFireStart    GrenadeEventKind = "fire_start"
+	GrenadeFireExpire   GrenadeEventKind = "fire_expire"
+	GrenadeDecoyStart   GrenadeEventKind = "decoy_start"
+	GrenadeDecoyExpire  GrenadeEventKind = "decoy_expire"
+)
+
+type MatchStartEvent struct{}
+
+type RoundStartEvent struct{}
+
+type RoundFreezetimeEndEvent struct{}
+
+type TeamSideSwitchEvent struct{}
+
+type FrameDoneEvent struct{}
+
+type RoundEndEvent struct {
+	Winner string
+	Reason int
+}
+
+// Player chat as well as messages printed by
+// the server and its plugins
+type ChatMessageEvent struct {
+	Text string
+	// False for messages sent by players
+	FromServer bool
+}
+
+// Only contains the convars that changed
+type ConVarsUpdatedEvent struct {
+	ConVars map[string]string
+}
+
+type KillEvent struct {
+	Killer            *DemoPlayer
+	Victim            *DemoPlayer
+	Assister          *DemoPlayer
+	Weapon            *DemoWeapon
+	IsHeadshot        bool
+	AssistedFlash     bool
+	AttackerBlind     bool
+	NoScope           bool
+	ThroughSmoke      bool
+	PenetratedObjects int
+}
+
+type PlayerHurtEvent struct {
+	Player            *DemoPlayer
+	Attacker          *DemoPlayer
+	Weapon            *DemoWeapon
+	HealthDamageTaken int
+	HitGroup          HitGroup
+}
+
+type PlayerFlashedEvent struct {
+	Player        *DemoPlayer
+	Attacker      *DemoPlayer
+	FlashDuration time.Duration
+	// Zero if the flash can't be tied back to a projectile
+	ProjectileId int
+}
+
+type PlayerDisconnectedEvent struct {
+	Player *DemoPlayer
+}
+
+type WeaponFireEvent struct {
+	Shooter *DemoPlayer
+	Weapon  *DemoWeapon
+}
+
+// The position is the player's for the plant and defuse
+// start events and the bomb's for all of the others
+type BombEvent struct {
+	Kind     BombEventKind
+	Player   *DemoPlayer
+	Position r3.Vector
+}
+
+type GrenadeThrowEvent struct {
+	Projectile DemoProjectile
+}
+
+type GrenadeEvent struct {
+	Kind       GrenadeEventKind
+	Projectile DemoProjectile
+}
+
+type GrenadeDestroyEvent struct {
+	Projectile DemoProjectile
+}
+
+// Peeks at the magic bytes without consuming them so that the same
+// reader can be handed to the parser afterwards
+func getDemoFormat(r *bufio.Reader) (string, error) {
+	magic, err := r.Peek(len(CSGODemoMagic))
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case bytes.Equal(magic, CSGODemoMagic):
+		return DemoFormatCSGO, nil
+	case bytes.Equal(magic, CS2DemoMagic):
+		return DemoFormatCS2, nil
+	}
+
+	return "", ErrUnknownDemoFormat
+}
+
+// The reader doesn't need to be seekable, which lets
+// compressed demos be streamed straight into the parser
+func newDemoBackend(r io.Reader) (DemoBackend, error) {
+	br := bufio.NewReader(r)
+	format, err := getDemoFormat(br)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == DemoFormatCS2 {
+		return newCS2Backend(br)
+	}
+
+	return newCSGOBackend(br), nil
+}
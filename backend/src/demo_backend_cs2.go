@@ -0,0 +1,39 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// Source 2 demos are a completely different (protobuf based) format which
+// needs demoinfocs-golang v4 or newer to read. That library isn't one of our
+// dependencies yet, so for now we will detect CS2 demos from their header
+// and reject them with a clear error instead of letting the CS:GO parser
+// choke on them. Once the dependency is added this should return a backend
+// which translates the v4 events into the types in demo_backend.go. Until
+// then CS2 demos are quarantined on their first failure rather than being
+// retried, and uploads of them are refused
+var ErrCS2Unsupported = errors.New("CS2 demos are not supported by this build yet")
+
+func newCS2Backend(r io.Reader) (DemoBackend, error) {
+	return nil, ErrCS2Unsupported
+}
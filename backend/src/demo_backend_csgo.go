@@ -0,0 +1,413 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/r3"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+	dispatch "github.com/markus-wa/godispatch"
+)
+
+// Wraps demoinfocs-golang v2, which can only read CS:GO demos
+type csgoBackend struct {
+	parser     dem.Parser
+	dispatcher dispatch.Dispatcher
+}
+
+type csgoGameState struct {
+	gs dem.GameState
+}
+
+func newCSGOBackend(r io.Reader) *csgoBackend {
+	b := &csgoBackend{parser: dem.NewParser(r)}
+	b.registerEventHandlers()
+	return b
+}
+
+func (b *csgoBackend) ParseHeader() (DemoHeader, error) {
+	header, err := b.parser.ParseHeader()
+	if err != nil {
+		return DemoHeader{}, err
+	}
+
+	mapMetadata := metadata.MapNameToMap[header.MapName]
+	return DemoHeader{
+		MapName:      header.MapName,
+		ServerName:   header.ServerName,
+		ClientName:   header.ClientName,
+		PlaybackTime: header.PlaybackTime,
+		Radar:        MapRadar{PZero: mapMetadata.PZero, Scale: mapMetadata.Scale},
+	}, nil
+}
+
+func (b *csgoBackend) RegisterEventHandler(handler interface{}) {
+	b.dispatcher.RegisterHandler(handler)
+}
+
+func (b *csgoBackend) ParseToEnd() error {
+	return b.parser.ParseToEnd()
+}
+
+func (b *csgoBackend) CurrentTime() time.Duration {
+	return b.parser.CurrentTime()
+}
+
+func (b *csgoBackend) GameState() DemoGameState {
+	return csgoGameState{gs: b.parser.GameState()}
+}
+
+func (b *csgoBackend) Close() {
+	b.parser.Close()
+}
+
+func (b *csgoBackend) registerEventHandlers() {
+	p := b.parser
+
+	p.RegisterEventHandler(func(e events.MatchStart) {
+		b.dispatcher.Dispatch(MatchStartEvent{})
+	})
+
+	p.RegisterEventHandler(func(e events.RoundStart) {
+		b.dispatcher.Dispatch(RoundStartEvent{})
+	})
+
+	p.RegisterEventHandler(func(e events.RoundFreezetimeEnd) {
+		b.dispatcher.Dispatch(RoundFreezetimeEndEvent{})
+	})
+
+	p.RegisterEventHandler(func(e events.TeamSideSwitch) {
+		b.dispatcher.Dispatch(TeamSideSwitchEvent{})
+	})
+
+	p.RegisterEventHandler(func(e events.FrameDone) {
+		b.dispatcher.Dispatch(FrameDoneEvent{})
+	})
+
+	p.RegisterEventHandler(func(e events.ChatMessage) {
+		b.dispatcher.Dispatch(ChatMessageEvent{Text: e.Text, FromServer: false})
+	})
+
+	// Server and plugin messages (e.g. "[PugSetup] ...")
+	// come through as SayText rather than ChatMessage
+	p.RegisterEventHandler(func(e events.SayText) {
+		b.dispatcher.Dispatch(ChatMessageEvent{Text: e.Text, FromServer: true})
+	})
+
+	p.RegisterEventHandler(func(e events.SayText2) {
+		// Regular player chat is also sent as SayText2 with one of the
+		// Cstrike_Chat_* message names
+		if strings.HasPrefix(e.MsgName, "Cstrike_Chat") {
+			return
+		}
+
+		b.dispatcher.Dispatch(ChatMessageEvent{
+			Text:       e.MsgName + " " + strings.Join(e.Params, " "),
+			FromServer: true,
+		})
+	})
+
+	p.RegisterEventHandler(func(e events.ConVarsUpdated) {
+		b.dispatcher.Dispatch(ConVarsUpdatedEvent{ConVars: e.UpdatedConVars})
+	})
+
+	p.RegisterEventHandler(func(e events.RoundEnd) {
+		b.dispatcher.Dispatch(RoundEndEvent{
+			Winner: getSideName(e.Winner),
+			Reason: int(e.Reason),
+		})
+	})
+
+	p.RegisterEventHandler(func(e events.Kill) {
+		b.dispatcher.Dispatch(KillEvent{
+			Killer:            csgoPlayer(e.Killer),
+			Victim:            csgoPlayer(e.Victim),
+			Assister:          csgoPlayer(e.Assister),
+			Weapon:            csgoWeapon(e.Weapon),
+			IsHeadshot:        e.IsHeadshot,
+			AssistedFlash:     e.AssistedFlash,
+			AttackerBlind:     e.AttackerBlind,
+			NoScope:           e.NoScope,
+			ThroughSmoke:      e.ThroughSmoke,
+			PenetratedObjects: e.PenetratedObjects,
+		})
+	})
+
+	p.RegisterEventHandler(func(e events.PlayerHurt) {
+		b.dispatcher.Dispatch(PlayerHurtEvent{
+			Player:            csgoPlayer(e.Player),
+			Attacker:          csgoPlayer(e.Attacker),
+			Weapon:            csgoWeapon(e.Weapon),
+			HealthDamageTaken: e.HealthDamageTaken,
+			HitGroup:          csgoHitGroup(e.HitGroup),
+		})
+	})
+
+	p.RegisterEventHandler(func(e events.PlayerFlashed) {
+		var duration time.Duration = 0
+		if e.Player != nil {
+			duration = e.FlashDuration()
+		}
+
+		projectileId := 0
+		if e.Projectile != nil && e.Projectile.Entity != nil {
+			projectileId = e.Projectile.Entity.ID()
+		}
+
+		b.dispatcher.Dispatch(PlayerFlashedEvent{
+			Player:        csgoPlayer(e.Player),
+			Attacker:      csgoPlayer(e.Attacker),
+			FlashDuration: duration,
+			ProjectileId:  projectileId,
+		})
+	})
+
+	p.RegisterEventHandler(func(e events.PlayerDisconnected) {
+		if e.Player == nil {
+			return
+		}
+
+		b.dispatcher.Dispatch(PlayerDisconnectedEvent{Player: csgoPlayer(e.Player)})
+	})
+
+	p.RegisterEventHandler(func(e events.WeaponFire) {
+		b.dispatcher.Dispatch(WeaponFireEvent{
+			Shooter: csgoPlayer(e.Shooter),
+			Weapon:  csgoWeapon(e.Weapon),
+		})
+	})
+
+	p.RegisterEventHandler(func(e events.BombPlantBegin) {
+		b.dispatcher.Dispatch(BombEvent{Kind: BombPlantBegin, Player: csgoPlayer(e.Player), Position: e.Player.Position()})
+	})
+
+	p.RegisterEventHandler(func(e events.BombPlanted) {
+		b.dispatcher.Dispatch(BombEvent{Kind: BombPlanted, Player: csgoPlayer(e.Player), Position: p.GameState().Bomb().Position()})
+	})
+
+	p.RegisterEventHandler(func(e events.BombDefuseStart) {
+		b.dispatcher.Dispatch(BombEvent{Kind: BombDefuseBegin, Player: csgoPlayer(e.Player), Position: e.Player.Position()})
+	})
+
+	p.RegisterEventHandler(func(e events.BombDefused) {
+		b.dispatcher.Dispatch(BombEvent{Kind: BombDefused, Player: csgoPlayer(e.Player), Position: p.GameState().Bomb().Position()})
+	})
+
+	p.RegisterEventHandler(func(e events.BombExplode) {
+		b.dispatcher.Dispatch(BombEvent{Kind: BombExplode, Position: p.GameState().Bomb().Position()})
+	})
+
+	p.RegisterEventHandler(func(e events.GrenadeProjectileThrow) {
+		if e.Projectile.WeaponInstance == nil {
+			return
+		}
+
+		b.dispatcher.Dispatch(GrenadeThrowEvent{Projectile: csgoProjectile(e.Projectile)})
+	})
+
+	p.RegisterEventHandler(func(e events.GrenadeEventIf) {
+		kind := getCSGOGrenadeEventKind(e)
+		if kind == "" {
+			return
+		}
+
+		base := e.Base()
+		b.dispatcher.Dispatch(GrenadeEvent{
+			Kind: kind,
+			Projectile: DemoProjectile{
+				EntityId: base.GrenadeEntityID,
+				Type:     base.GrenadeType,
+				Thrower:  csgoPlayer(base.Thrower),
+				Position: base.Position,
+			},
+		})
+	})
+
+	p.RegisterEventHandler(func(e events.GrenadeProjectileDestroy) {
+		b.dispatcher.Dispatch(GrenadeDestroyEvent{Projectile: csgoProjectile(e.Projectile)})
+	})
+}
+
+func (s csgoGameState) Participants() []*DemoPlayer {
+	return csgoPlayers(s.gs.Participants().All())
+}
+
+func (s csgoGameState) Playing() []*DemoPlayer {
+	return csgoPlayers(s.gs.Participants().Playing())
+}
+
+func (s csgoGameState) Team(side string) *DemoTeam {
+	var team *common.TeamState
+	switch side {
+	case "CT":
+		team = s.gs.TeamCounterTerrorists()
+	case "T":
+		team = s.gs.TeamTerrorists()
+	}
+
+	if team == nil {
+		return nil
+	}
+
+	return &DemoTeam{
+		ClanName:                    team.ClanName(),
+		Score:                       team.Score(),
+		FreezeTimeEndEquipmentValue: team.FreezeTimeEndEquipmentValue(),
+		MoneySpentThisRound:         team.MoneySpentThisRound(),
+		Members:                     csgoPlayers(team.Members()),
+	}
+}
+
+func (s csgoGameState) GrenadeProjectiles() []DemoProjectile {
+	ret := make([]DemoProjectile, 0)
+	for _, grenade := range s.gs.GrenadeProjectiles() {
+		if grenade.WeaponInstance == nil {
+			continue
+		}
+		ret = append(ret, csgoProjectile(grenade))
+	}
+	return ret
+}
+
+func (s csgoGameState) BombPosition() r3.Vector {
+	return s.gs.Bomb().Position()
+}
+
+func (s csgoGameState) Rules() DemoRules {
+	conVars := s.gs.Rules().ConVars()
+
+	// Missing convars will just fail to parse and come out as zero
+	maxRounds, _ := strconv.Atoi(conVars["mp_maxrounds"])
+	overtimeMaxRounds, _ := strconv.Atoi(conVars["mp_overtime_maxrounds"])
+
+	return DemoRules{
+		MaxRounds:         maxRounds,
+		OvertimeMaxRounds: overtimeMaxRounds,
+	}
+}
+
+func csgoPlayer(player *common.Player) *DemoPlayer {
+	if player == nil {
+		return nil
+	}
+
+	var weapon *DemoWeapon = nil
+	if player.ActiveWeapon() != nil {
+		weapon = csgoWeapon(player.ActiveWeapon())
+	}
+
+	return &DemoPlayer{
+		EntityId:            player.EntityID,
+		SteamID64:           player.SteamID64,
+		Name:                player.Name,
+		IsBot:               player.IsBot,
+		IsConnected:         player.IsConnected,
+		IsAlive:             player.IsAlive(),
+		Side:                getSideName(player.Team),
+		Position:            player.Position(),
+		ViewDirectionX:      player.ViewDirectionX(),
+		Health:              player.Health(),
+		Money:               player.Money(),
+		MoneySpentThisRound: player.MoneySpentThisRound(),
+		ActiveWeapon:        weapon,
+		LastPlaceName:       player.LastPlaceName(),
+	}
+}
+
+func csgoPlayers(players []*common.Player) []*DemoPlayer {
+	ret := make([]*DemoPlayer, 0, len(players))
+	for _, player := range players {
+		ret = append(ret, csgoPlayer(player))
+	}
+	return ret
+}
+
+// Weapons are never nil so that the handlers don't have to check for them
+func csgoWeapon(weapon *common.Equipment) *DemoWeapon {
+	if weapon == nil {
+		return &DemoWeapon{Type: common.EqUnknown}
+	}
+
+	return &DemoWeapon{
+		Type:           weapon.Type,
+		OriginalString: weapon.OriginalString,
+	}
+}
+
+func csgoProjectile(grenade *common.GrenadeProjectile) DemoProjectile {
+	grenadeType := common.EqUnknown
+	if grenade.WeaponInstance != nil {
+		grenadeType = grenade.WeaponInstance.Type
+	}
+
+	return DemoProjectile{
+		EntityId: grenade.Entity.ID(),
+		Type:     grenadeType,
+		Thrower:  csgoPlayer(grenade.Thrower),
+		Position: grenade.Position(),
+	}
+}
+
+func csgoHitGroup(hitGroup events.HitGroup) HitGroup {
+	switch hitGroup {
+	case events.HitGroupGeneric:
+		return HitGroupGeneric
+	case events.HitGroupHead:
+		return HitGroupHead
+	case events.HitGroupChest:
+		return HitGroupChest
+	case events.HitGroupStomach:
+		return HitGroupStomach
+	case events.HitGroupLeftArm, events.HitGroupRightArm:
+		return HitGroupArm
+	case events.HitGroupLeftLeg, events.HitGroupRightLeg:
+		return HitGroupLeg
+	}
+	return HitGroupOther
+}
+
+func getCSGOGrenadeEventKind(e events.GrenadeEventIf) GrenadeEventKind {
+	switch e.(type) {
+	case events.HeExplode:
+		return GrenadeHeExplode
+	case events.FlashExplode:
+		return GrenadeFlashExplode
+	case events.SmokeStart:
+		return GrenadeSmokeStart
+	case events.SmokeExpired:
+		return GrenadeSmokeExpire
+	case events.FireGrenadeStart:
+		return GrenadeFireStart
+	case events.FireGrenadeExpired:
+		return GrenadeFireExpire
+	case events.DecoyStart:
+		return GrenadeDecoyStart
+	case events.DecoyExpired:
+		return GrenadeDecoyExpire
+	}
+	return ""
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DemoTypeSourceHeader   = "header"
+	DemoTypeSourceChat     = "chat"
+	DemoTypeSourceConVar   = "cvar"
+	DemoTypeSourceRoot     = "root"
+	DemoTypeSourceFileName = "filename"
+	DemoTypeSourceDefault  = "default"
+
+	DateSourceMtime    = "mtime"
+	DateSourceFileName = "filename"
+	DateSourceNow      = "now"
+
+	DefaultDemoType = "steam"
+)
+
+var DemoTypes = []string{"esea", "pugsetup", "faceit", "steam"}
+
+func isDemoType(demoType string) bool {
+	for _, t := range DemoTypes {
+		if t == demoType {
+			return true
+		}
+	}
+	return false
+}
+
+type DemoTypeRule struct {
+	prefix   string
+	demoType string
+}
+
+func (r DemoTypeRule) String() string {
+	return r.prefix + ":" + r.demoType
+}
+
+// Case-insensitive substrings that identify where the demo came from. The
+// Valve marker is only checked against the header since players could
+// easily say it in chat
+var (
+	ServerDemoTypeMarkers = map[string]string{
+		"esea":     "esea",
+		"faceit":   "faceit",
+		"pugsetup": "pugsetup",
+	}
+	HeaderDemoTypeMarkers = map[string]string{
+		"esea":     "esea",
+		"faceit":   "faceit",
+		"pugsetup": "pugsetup",
+		"valve":    "steam",
+	}
+)
+
+var (
+	DateRegex1 = regexp.MustCompile(`(\d\d\d\d)-(\d\d)-(\d\d)`)
+	DateRegex2 = regexp.MustCompile(`(\d\d\d\d)_(\d\d)_(\d\d)`)
+	DateRegex3 = regexp.MustCompile(`(\d\d\d\d)/(\d\d)/(\d\d)`)
+)
+
+// Returns an empty string if none of the markers are in the text
+func findDemoTypeMarker(text string, markers map[string]string) string {
+	text = strings.ToLower(text)
+	for _, demoType := range DemoTypes {
+		for marker, markerType := range markers {
+			if markerType == demoType && strings.Contains(text, marker) {
+				return demoType
+			}
+		}
+	}
+	return ""
+}
+
+// The header is checked first, then the default for the demo folder that
+// the demo is in, then the configured file name rules. The demo's chat and
+// convars can still override anything but the header while the demo is
+// being parsed
+func getDemoType(config Config, header DemoHeader, path string) (string, string) {
+	demoType := findDemoTypeMarker(header.ServerName+" "+header.ClientName, HeaderDemoTypeMarkers)
+	if demoType != "" {
+		return demoType, DemoTypeSourceHeader
+	}
+
+	root := getDemoRoot(config.demoRoots, path)
+	if root.demoType != "" {
+		return root.demoType, DemoTypeSourceRoot
+	}
+
+	demoFileName := getDemoFileName(path)
+	for _, rule := range config.demoTypeRules {
+		if strings.HasPrefix(demoFileName, rule.prefix) {
+			return rule.demoType, DemoTypeSourceFileName
+		}
+	}
+
+	return DefaultDemoType, DemoTypeSourceDefault
+}
+
+// Tries each of the configured date sources in order and falls back
+// to the current time if none of them work
+func getDemoTime(config Config, logger *Logger, store DemoStore, path string, header DemoHeader) (time.Time, string) {
+	for _, source := range config.demoDateSources {
+		switch source {
+		case DateSourceMtime:
+			info, err := store.Stat(path)
+			if err != nil {
+				logger.Warnf("failed to stat demo file: %s", err.Error())
+				continue
+			}
+
+			// The file is last written to when the recording stops
+			// so we have to go back to when it started
+			return info.ModTime.Add(-header.PlaybackTime), DateSourceMtime
+		case DateSourceFileName:
+			demoTime, ok := getDemoTimeFromFileName(config, logger, getDemoFileName(path))
+			if ok {
+				return demoTime, DateSourceFileName
+			}
+		}
+	}
+
+	return time.Now(), DateSourceNow
+}
+
+func getDemoTimeFromFileName(config Config, logger *Logger, demoFileName string) (time.Time, bool) {
+	matches := DateRegex1.FindStringSubmatch(demoFileName)
+	if matches == nil {
+		matches = DateRegex2.FindStringSubmatch(demoFileName)
+	}
+
+	if matches == nil {
+		matches = DateRegex3.FindStringSubmatch(demoFileName)
+	}
+
+	if matches == nil {
+		return time.Time{}, false
+	}
+
+	// TODO: should probably come back to this and be a
+	// little smarter about which matched field is the day
+	// and which is the month
+	loc, err := time.LoadLocation(config.timezone)
+	if err != nil {
+		logger.Errorf("failed to load timezone: %s", err.Error())
+		return time.Time{}, false
+	}
+
+	demoTime, err := time.ParseInLocation("2006-01-02", matches[1]+"-"+matches[2]+"-"+matches[3], loc)
+	if err != nil {
+		logger.Errorf("failed to parse time: %s", err.Error())
+		return time.Time{}, false
+	}
+
+	return demoTime, true
+}
+
+func demoTypeRulesString(rules []DemoTypeRule) string {
+	ret := make([]string, len(rules))
+	for i, rule := range rules {
+		ret[i] = rule.String()
+	}
+	return strings.Join(ret, ", ")
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetDemoTime(t *testing.T) {
+	dir := t.TempDir()
+	header := DemoHeader{PlaybackTime: 40 * time.Minute}
+	mtime := time.Date(2022, 7, 14, 21, 40, 0, 0, time.UTC)
+
+	dated := filepath.Join(dir, "pug_de_mirage_2022-06-30.dem")
+	undated := filepath.Join(dir, "pug_de_mirage.dem")
+	for _, path := range []string{dated, undated} {
+		if err := os.WriteFile(path, []byte("HL2DEMO\x00"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sources []string
+		path    string
+		want    time.Time
+		source  string
+	}{
+		// The default order only falls back to the modified time
+		// when there is no date in the file name
+		{[]string{"filename", "mtime"}, dated, time.Date(2022, 6, 30, 0, 0, 0, 0, time.UTC), DateSourceFileName},
+		{[]string{"filename", "mtime"}, undated, time.Date(2022, 7, 14, 21, 0, 0, 0, time.UTC), DateSourceMtime},
+		{[]string{"mtime", "filename"}, dated, time.Date(2022, 7, 14, 21, 0, 0, 0, time.UTC), DateSourceMtime},
+		{[]string{"filename"}, undated, time.Time{}, DateSourceNow},
+	}
+
+	for _, test := range tests {
+		config := Config{demoDateSources: test.sources, timezone: "UTC"}
+		got, source := getDemoTime(config, newLogger(false), LocalDemoStore{}, test.path, header)
+
+		if source != test.source {
+			t.Errorf("%v %s: got source %s, want %s", test.sources, test.path, source, test.source)
+		} else if source != DateSourceNow && !got.Equal(test.want) {
+			t.Errorf("%v %s: got %s, want %s", test.sources, test.path, got, test.want)
+		}
+	}
+}
+
+func TestDefaultDemoDateSources(t *testing.T) {
+	t.Setenv("PUGGIES_DEMO_DATE_SOURCES", "")
+	sources, err := demoDateSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sources) != 2 || sources[0] != DateSourceFileName || sources[1] != DateSourceMtime {
+		t.Errorf("got default date sources %v, want filename then mtime", sources)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A directory which is searched (recursively) for demos
+type DemoRoot struct {
+	path string
+	// Used as the demo type when it can't be detected from the demo
+	// itself. Empty if the usual file name rules should be used
+	demoType string
+	// Added to all of the matches from demos in this directory
+	tags []string
+}
+
+func (r DemoRoot) String() string {
+	ret := r.path
+	if r.demoType != "" {
+		ret += ";type=" + r.demoType
+	}
+	if len(r.tags) > 0 {
+		ret += ";tags=" + strings.Join(r.tags, "|")
+	}
+	return ret
+}
+
+func demoRootsString(roots []DemoRoot) string {
+	ret := make([]string, len(roots))
+	for i, root := range roots {
+		ret[i] = root.String()
+	}
+	return strings.Join(ret, ", ")
+}
+
+// Returns the root that the demo is in. If the roots are nested the
+// innermost one is used. Returns an empty root if the demo isn't in
+// any of them (e.g. when parsing a single demo from the command line)
+func getDemoRoot(roots []DemoRoot, path string) DemoRoot {
+	var found DemoRoot
+	for _, root := range roots {
+		if strings.HasPrefix(path, root.path+"/") && len(root.path) > len(found.path) {
+			found = root
+		}
+	}
+	return found
+}
+
+// Demos are identified by their file name but can be anywhere inside of
+// the demo roots, so this keeps track of where each one is
+type DemoIndex struct {
+	mu    sync.RWMutex
+	store DemoStore
+	roots []DemoRoot
+	// demo ID -> path to the demo file
+	paths map[string]string
+}
+
+func newDemoIndex(roots []DemoRoot, store DemoStore) *DemoIndex {
+	return &DemoIndex{
+		store: store,
+		roots: roots,
+		paths: make(map[string]string),
+	}
+}
+
+// Walks all of the demo roots and rebuilds the index from scratch. Returns
+// the paths to all of the demos that were found. If two demos have the
+// same file name only the first one found is used. Each demo belongs to
+// the innermost root that it's in so nested roots aren't listed twice
+func (d *DemoIndex) scan(logger *Logger) ([]string, error) {
+	paths := make(map[string]string)
+	files := make([]string, 0)
+
+	for _, root := range d.roots {
+		objects, err := d.store.List(root.path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range objects {
+			if !isDemoFile(filepath.Base(object.Path)) {
+				continue
+			}
+
+			// Demos in a root that's nested inside of this one are
+			// picked up when that root is listed
+			if inner := getDemoRoot(d.roots, object.Path); len(inner.path) > len(root.path) {
+				continue
+			}
+
+			id := getDemoFileName(object.Path)
+			if existing, ok := paths[id]; ok {
+				logger.Warnf("demo=%s found in more than one place, using %s and ignoring %s", id, existing, object.Path)
+				continue
+			}
+
+			paths[id] = object.Path
+			files = append(files, object.Path)
+		}
+	}
+
+	d.mu.Lock()
+	d.paths = paths
+	d.mu.Unlock()
+
+	return files, nil
+}
+
+func (d *DemoIndex) add(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paths[getDemoFileName(path)] = path
+}
+
+func (d *DemoIndex) remove(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := getDemoFileName(path)
+	if d.paths[id] == path {
+		delete(d.paths, id)
+	}
+}
+
+// Returns the path to the demo with the given ID. The error satisfies
+// os.IsNotExist if there is no such demo
+func (d *DemoIndex) find(id string) (string, error) {
+	d.mu.RLock()
+	path, ok := d.paths[id]
+	d.mu.RUnlock()
+
+	if !ok {
+		return "", &os.PathError{Op: "find", Path: id, Err: os.ErrNotExist}
+	}
+
+	// The file could have been removed without us noticing
+	_, err := d.store.Stat(path)
+	if os.IsNotExist(err) {
+		d.remove(path)
+	}
+
+	return path, err
+}
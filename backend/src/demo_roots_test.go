@@ -0,0 +1,120 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDemoIndexNestedRoots(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"pug_de_dust2.dem",
+		"season1/pug_de_inferno.dem",
+		"esea/esea_de_nuke.dem",
+		"esea/season1/esea_de_mirage.dem.gz",
+	}
+
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(testDemo), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roots := []DemoRoot{
+		{path: dir, tags: []string{"pugs"}},
+		{path: filepath.Join(dir, "esea"), demoType: "esea"},
+	}
+
+	index := newDemoIndex(roots, LocalDemoStore{})
+	found, err := index.scan(newLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every demo is only found once, from the root that it belongs to
+	sort.Strings(found)
+	want := make([]string, len(files))
+	for i, file := range files {
+		want[i] = filepath.Join(dir, file)
+	}
+	sort.Strings(want)
+
+	if strings.Join(found, ",") != strings.Join(want, ",") {
+		t.Fatalf("got demos %v, want %v", found, want)
+	}
+
+	for _, path := range found {
+		root := getDemoRoot(roots, path)
+		isEsea := strings.HasPrefix(path, filepath.Join(dir, "esea")+"/")
+		if isEsea && root.demoType != "esea" || !isEsea && root.demoType != "" {
+			t.Errorf("%s got the settings from root %s", path, root.path)
+		}
+	}
+}
+
+func TestDemoRootsConfig(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+		valid bool
+	}{
+		{"/demos", []string{"/demos"}, true},
+		{"/demos/", []string{"/demos"}, true},
+		{"/demos/./pugs//,/demos/esea", []string{"/demos/pugs", "/demos/esea"}, true},
+		{"/demos,/demos/esea;type=esea", []string{"/demos", "/demos/esea"}, true},
+		{"/demos,/demos/", nil, false},
+		{"/demos;tags=a,/demos/pugs/../;tags=b", nil, false},
+		{"/demos,", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Setenv("PUGGIES_DEMOS_PATH", test.value)
+		roots, err := demoRoots()
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%q: got roots %v, want an error", test.value, roots)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", test.value, err)
+			continue
+		}
+
+		got := make([]string, len(roots))
+		for i, root := range roots {
+			got[i] = root.path
+		}
+
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%q: got roots %v, want %v", test.value, got, test.want)
+		}
+	}
+}
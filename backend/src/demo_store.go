@@ -0,0 +1,132 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DemoObject struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Where the demos are kept. Paths look like local paths no matter which
+// store is used (e.g. /demos/pugs/pug_de_mirage.dem) so that the demo roots
+// work the same way. Other stores map them onto their own keys
+type DemoStore interface {
+	// Recursively lists every file under the directory
+	List(dir string) ([]DemoObject, error)
+	// The error satisfies os.IsNotExist if there is no such file
+	Stat(path string) (DemoObject, error)
+	Open(path string) (io.ReadCloser, error)
+	Delete(path string) error
+	// Moves a finished file from the local filesystem into the store
+	Put(path, localPath string) error
+	// Where files that are going to be put into the directory should be
+	// written while they're being uploaded or downloaded. Always local
+	TempDir(dir string) string
+	// Sends the file to the client as a download
+	Serve(ginc *gin.Context, path string)
+	// Whether the files are on the local filesystem, which means they can
+	// be watched for changes with inotify instead of by polling
+	IsLocal() bool
+}
+
+func newDemoStore(config Config) (DemoStore, error) {
+	// demoStore has been checked by this point -- no need for default case
+	switch config.demoStore {
+	case "s3":
+		return newS3DemoStore(config)
+	}
+
+	return LocalDemoStore{}, nil
+}
+
+type LocalDemoStore struct{}
+
+func (LocalDemoStore) List(dir string) ([]DemoObject, error) {
+	objects := make([]DemoObject, 0)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, DemoObject{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+
+	return objects, err
+}
+
+func (LocalDemoStore) Stat(path string) (DemoObject, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return DemoObject{}, err
+	}
+
+	return DemoObject{Path: path, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (LocalDemoStore) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (LocalDemoStore) Delete(path string) error {
+	return os.Remove(path)
+}
+
+// The temp files are in the same directory so this is atomic
+func (LocalDemoStore) Put(path, localPath string) error {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(localPath, path)
+}
+
+func (LocalDemoStore) TempDir(dir string) string {
+	return dir
+}
+
+func (LocalDemoStore) Serve(ginc *gin.Context, path string) {
+	ginc.FileAttachment(path, filepath.Base(path))
+}
+
+func (LocalDemoStore) IsLocal() bool {
+	return true
+}
@@ -0,0 +1,457 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long a presigned download link works for
+const S3PresignExpiry = 15 * time.Minute
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3TimeFormat     = "20060102T150405Z"
+	s3DateFormat     = "20060102"
+	s3ListObjectsMax = "1000"
+)
+
+// Stores the demos in an S3 compatible bucket (AWS, MinIO, etc.). Demo
+// paths are used as the object keys without the leading slash. Only the
+// handful of requests that we need are implemented, signed with AWS
+// signature version 4
+type S3DemoStore struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	presign   bool
+	tempDir   string
+	client    *http.Client
+}
+
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func newS3DemoStore(config Config) (*S3DemoStore, error) {
+	endpoint := config.s3Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + config.s3Region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid S3 endpoint %s", endpoint)
+	}
+
+	return &S3DemoStore{
+		endpoint:  u,
+		bucket:    config.s3Bucket,
+		region:    config.s3Region,
+		accessKey: config.s3AccessKey,
+		secretKey: config.s3SecretKey,
+		pathStyle: config.s3PathStyle,
+		presign:   config.s3PresignDownloads,
+		tempDir:   join(config.dataPath, "uploads"),
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: 30 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+			},
+		},
+	}, nil
+}
+
+func s3Key(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// Escapes everything except the unreserved characters (and optionally the
+// slashes), which is what the signature calculation expects
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		unreserved := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~'
+
+		if unreserved || (keepSlash && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (s *S3DemoStore) objectUrl(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+
+	u.RawPath = s3Escape(u.Path, true)
+	u.RawQuery = s3CanonicalQuery(query)
+	return &u
+}
+
+func (s *S3DemoStore) scope(now time.Time) string {
+	return now.Format(s3DateFormat) + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s *S3DemoStore) signature(now time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3TimeFormat),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+s.secretKey), now.Format(s3DateFormat))
+	key = hmacSha256(key, s.region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	return hex.EncodeToString(hmacSha256(key, stringToSign))
+}
+
+func (s *S3DemoStore) newRequest(method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := s.objectUrl(key, query)
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedBody)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.RawPath,
+		u.RawQuery,
+		"host:" + u.Host,
+		"x-amz-content-sha256:" + s3UnsignedBody,
+		"x-amz-date:" + now.Format(s3TimeFormat),
+		"",
+		signedHeaders,
+		s3UnsignedBody,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm,
+		s.accessKey,
+		s.scope(now),
+		signedHeaders,
+		s.signature(now, canonicalRequest),
+	))
+
+	return req, nil
+}
+
+// Sends the request and turns any error responses into errors. A missing
+// object is returned as an error that satisfies os.IsNotExist
+func (s *S3DemoStore) do(req *http.Request, path string) (*http.Response, error) {
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, &os.PathError{Op: strings.ToLower(req.Method), Path: path, Err: os.ErrNotExist}
+	}
+
+	// HEAD responses don't have a body to get the error from
+	var s3Err s3Error
+	if xml.NewDecoder(res.Body).Decode(&s3Err) != nil || s3Err.Code == "" {
+		return nil, fmt.Errorf("S3 request failed with %s", res.Status)
+	}
+
+	return nil, fmt.Errorf("S3 request failed with %s: %s", s3Err.Code, s3Err.Message)
+}
+
+func (s *S3DemoStore) List(dir string) ([]DemoObject, error) {
+	// The bucket root has no prefix at all, otherwise only match whole
+	// directory names so that /demos doesn't pick up /demos-old
+	prefix := strings.TrimSuffix(s3Key(dir), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	objects := make([]DemoObject, 0)
+	query := url.Values{
+		"list-type": {"2"},
+		"max-keys":  {s3ListObjectsMax},
+		"prefix":    {prefix},
+	}
+
+	for {
+		req, err := s.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := s.do(req, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			// Folders made in the S3 web consoles are empty objects
+			if strings.HasSuffix(object.Key, "/") {
+				continue
+			}
+
+			objects = append(objects, DemoObject{
+				Path:    "/" + object.Key,
+				Size:    object.Size,
+				ModTime: object.LastModified,
+			})
+		}
+
+		if !result.IsTruncated {
+			return objects, nil
+		}
+
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *S3DemoStore) Stat(path string) (DemoObject, error) {
+	req, err := s.newRequest(http.MethodHead, s3Key(path), nil, nil)
+	if err != nil {
+		return DemoObject{}, err
+	}
+
+	res, err := s.do(req, path)
+	if err != nil {
+		return DemoObject{}, err
+	}
+	res.Body.Close()
+
+	modTime, err := http.ParseTime(res.Header.Get("Last-Modified"))
+	if err != nil {
+		return DemoObject{}, err
+	}
+
+	return DemoObject{Path: path, Size: res.ContentLength, ModTime: modTime}, nil
+}
+
+func (s *S3DemoStore) Open(path string) (io.ReadCloser, error) {
+	req, err := s.newRequest(http.MethodGet, s3Key(path), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(req, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+func (s *S3DemoStore) Delete(path string) error {
+	req, err := s.newRequest(http.MethodDelete, s3Key(path), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req, path)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// Objects only show up once they've been completely uploaded
+// so nothing can see the demo until it's all there
+func (s *S3DemoStore) Put(path, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(http.MethodPut, s3Key(path), nil, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+
+	res, err := s.do(req, path)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return os.Remove(localPath)
+}
+
+func (s *S3DemoStore) TempDir(dir string) string {
+	return s.tempDir
+}
+
+// Returns a link to the object that anyone can use to download
+// it without credentials until it expires
+func (s *S3DemoStore) presignedUrl(path string) string {
+	now := time.Now().UTC()
+	query := url.Values{
+		"X-Amz-Algorithm":              {s3Algorithm},
+		"X-Amz-Credential":             {s.accessKey + "/" + s.scope(now)},
+		"X-Amz-Date":                   {now.Format(s3TimeFormat)},
+		"X-Amz-Expires":                {strconv.Itoa(int(S3PresignExpiry.Seconds()))},
+		"X-Amz-SignedHeaders":          {"host"},
+		"response-content-disposition": {fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(path))},
+	}
+
+	u := s.objectUrl(s3Key(path), query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.RawPath,
+		u.RawQuery,
+		"host:" + u.Host,
+		"",
+		"host",
+		s3UnsignedBody,
+	}, "\n")
+
+	u.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+	return u.String()
+}
+
+// Either redirects the client to a presigned link so that the demo is
+// downloaded straight from the bucket, or streams the demo through us
+// (for when the bucket isn't reachable by the users)
+func (s *S3DemoStore) Serve(ginc *gin.Context, path string) {
+	if s.presign {
+		ginc.Redirect(http.StatusFound, s.presignedUrl(path))
+		return
+	}
+
+	req, err := s.newRequest(http.MethodGet, s3Key(path), nil, nil)
+	if err != nil {
+		ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := s.do(req, path)
+	if os.IsNotExist(err) {
+		ginc.JSON(http.StatusNotFound, gin.H{"error": "demo not found"})
+		return
+	} else if err != nil {
+		ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer res.Body.Close()
+
+	ginc.DataFromReader(
+		http.StatusOK,
+		res.ContentLength,
+		"application/octet-stream",
+		res.Body,
+		map[string]string{
+			"Content-Disposition": fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(path)),
+		},
+	)
+}
+
+func (s *S3DemoStore) IsLocal() bool {
+	return false
+}
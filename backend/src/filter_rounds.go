@@ -31,6 +31,16 @@ func filterByLiveRoundsInt(data []PlayerIntMap, isLive []bool) []PlayerIntMap {
 	return ret
 }
 
+func filterByLiveRoundsWeapons(data []PlayerWeaponMap, isLive []bool) []PlayerWeaponMap {
+	var ret []PlayerWeaponMap
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
 func filterByLiveRoundsOpeningKill(data []*OpeningKill, isLive []bool) []*OpeningKill {
 	var ret []*OpeningKill
 	for i, live := range isLive {
@@ -51,6 +61,36 @@ func filterByLiveRoundsH2H(data []map[uint64]map[uint64]Kill, isLive []bool) []m
 	return ret
 }
 
+func filterByLiveRoundsHeatmaps(data []HeatmapData, isLive []bool) []HeatmapData {
+	var ret []HeatmapData
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
+func filterByLiveRoundsReplays(data []RoundReplay, isLive []bool) []RoundReplay {
+	var ret []RoundReplay
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
+func filterByLiveRoundsUtility(data [][]*Grenade, isLive []bool) [][]*Grenade {
+	var ret [][]*Grenade
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
 func filterByLiveRoundsRounds(data []Round, isLive []bool) []Round {
 	var ret []Round
 	for i, live := range isLive {
@@ -61,6 +101,36 @@ func filterByLiveRoundsRounds(data []Round, isLive []bool) []Round {
 	return ret
 }
 
+func filterByLiveRoundsEconomy(data []RoundEconomy, isLive []bool) []RoundEconomy {
+	var ret []RoundEconomy
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
+func filterByLiveRoundsBool(data []bool, isLive []bool) []bool {
+	var ret []bool
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
+func filterByLiveRoundsNumber(data []int, isLive []bool) []int {
+	var ret []int
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
 func filterByLiveRoundsWinners(data [][]uint64, isLive []bool) [][]uint64 {
 	var ret [][]uint64
 	for i, live := range isLive {
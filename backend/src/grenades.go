@@ -0,0 +1,76 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func getGrenadeName(grenade common.EquipmentType) string {
+	switch grenade {
+	case common.EqFlash:
+		return "flash"
+	case common.EqHE:
+		return "he"
+	case common.EqSmoke:
+		return "smoke"
+	case common.EqMolotov:
+		return "molotov"
+	case common.EqIncendiary:
+		return "incendiary"
+	case common.EqDecoy:
+		return "decoy"
+	}
+
+	return "UNKNOWN"
+}
+
+func isFireGrenade(grenade common.EquipmentType) bool {
+	return grenade == common.EqMolotov || grenade == common.EqIncendiary
+}
+
+// Finds the most recently detonated grenade of the given type that was
+// thrown by the player. The damage and flash events don't reliably tell us
+// which grenade entity was responsible so this is the best we can do
+func findDetonatedGrenade(grenades []*Grenade, thrower uint64, weapon common.EquipmentType) *Grenade {
+	for i := len(grenades) - 1; i >= 0; i-- {
+		g := grenades[i]
+		if g.Thrower != thrower || !g.detonated {
+			continue
+		}
+
+		if g.equipment == weapon || (isFireGrenade(g.equipment) && isFireGrenade(weapon)) {
+			return g
+		}
+	}
+
+	return nil
+}
+
+func derefGrenadeArray(utility [][]*Grenade) [][]Grenade {
+	ret := make([][]Grenade, len(utility))
+	for i, round := range utility {
+		ret[i] = make([]Grenade, len(round))
+		for j, g := range round {
+			ret[i][j] = *g
+		}
+	}
+	return ret
+}
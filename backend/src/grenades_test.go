@@ -0,0 +1,65 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func TestFindDetonatedGrenade(t *testing.T) {
+	newGrenade := func(thrower uint64, equipment common.EquipmentType, detonated bool) *Grenade {
+		return &Grenade{
+			Type:      getGrenadeName(equipment),
+			Thrower:   thrower,
+			equipment: equipment,
+			detonated: detonated,
+		}
+	}
+
+	firstHE := newGrenade(1, common.EqHE, true)
+	secondHE := newGrenade(1, common.EqHE, true)
+	molotov := newGrenade(1, common.EqMolotov, true)
+	inAir := newGrenade(1, common.EqHE, false)
+	otherHE := newGrenade(2, common.EqHE, true)
+	grenades := []*Grenade{firstHE, molotov, secondHE, otherHE, inAir}
+
+	tests := []struct {
+		name    string
+		thrower uint64
+		weapon  common.EquipmentType
+		want    *Grenade
+	}{
+		// The one still in the air can't have done any damage yet
+		{"most recent", 1, common.EqHE, secondHE},
+		{"other thrower", 2, common.EqHE, otherHE},
+		// The fire is reported as an incendiary for either grenade
+		{"fire", 1, common.EqIncendiary, molotov},
+		{"none thrown", 1, common.EqFlash, nil},
+		{"nothing detonated", 3, common.EqHE, nil},
+	}
+
+	for _, test := range tests {
+		if got := findDetonatedGrenade(grenades, test.thrower, test.weapon); got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
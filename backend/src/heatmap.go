@@ -24,12 +24,12 @@ import (
 	"image/draw"
 	"image/jpeg"
 	"os"
-	"strings"
+	"path/filepath"
+	"strconv"
 
 	heatmap "github.com/dustin/go-heatmap"
 	schemes "github.com/dustin/go-heatmap/schemes"
 	r2 "github.com/golang/geo/r2"
-	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 )
 
 const (
@@ -38,36 +38,59 @@ const (
 	jpegQuality = 90
 )
 
-func getHeatmapFileName(demoPath string, dataSet string) string {
-	return strings.Replace(demoPath[strings.LastIndex(demoPath, "/")+1:], ".dem", "-"+dataSet+".png", 1)
+var HeatmapDatasets = []string{"shotsFired", "kills", "deaths"}
+
+func isHeatmapDataset(dataSet string) bool {
+	for _, d := range HeatmapDatasets {
+		if d == dataSet {
+			return true
+		}
+	}
+	return false
+}
+
+// Rendered heatmaps are cached in a folder per match so they can all be
+// thrown away at once when the match is re-parsed, renamed or deleted
+func getHeatmapCacheDir(heatmapsDir, demoId string) string {
+	return join(heatmapsDir, demoId)
 }
 
-func genHeatmap(points []r2.Point,
-	header common.DemoHeader,
-	outPath, mapsPath string,
-) error {
-	// Find bounding rectangle for points to get around the normalization done by the heatmap library
-	r2Bounds := r2.RectFromPoints(points...)
-	padding := float64(dotSize) / 2.0 // Calculating padding amount to avoid shrinkage by the heatmap library
-	bounds := image.Rectangle{
-		Min: image.Point{X: int(r2Bounds.X.Lo - padding), Y: int(r2Bounds.Y.Lo - padding)},
-		Max: image.Point{X: int(r2Bounds.X.Hi + padding), Y: int(r2Bounds.Y.Hi + padding)},
+func getHeatmapFileName(dataSet string, player uint64, side string) string {
+	if side == "" {
+		side = "all"
 	}
+	return dataSet + "-" + strconv.FormatUint(player, 10) + "-" + side + ".jpg"
+}
+
+func clearHeatmapCache(heatmapsDir, demoId string) error {
+	return os.RemoveAll(getHeatmapCacheDir(heatmapsDir, demoId))
+}
 
-	// Transform r2.Points into heatmap.DataPoints
-	var data []heatmap.DataPoint
-	for _, p := range points[1:] {
-		// Invert Y since go-heatmap expects data to be ordered from bottom to top
-		data = append(data, heatmap.P(p.X, p.Y*-1))
+// player == 0 or side == "" means don't filter on that field
+func filterHeatmapPoints(points []HeatmapPoint, player uint64, side string) []r2.Point {
+	ret := make([]r2.Point, 0, len(points))
+	for _, p := range points {
+		if player != 0 && p.Player != player {
+			continue
+		}
+		if side != "" && p.Side != side {
+			continue
+		}
+		ret = append(ret, r2.Point{X: p.X, Y: p.Y})
 	}
+	return ret
+}
 
+func genHeatmap(points []r2.Point, mapName, outPath, mapsPath string) error {
 	// Load map overview image
-	mapPath := join(mapsPath, header.MapName+".jpg")
+	mapPath := join(mapsPath, mapName+".jpg")
 	fMap, err := os.Open(mapPath)
 	if err != nil {
 		return err
 	}
 
+	defer fMap.Close()
+
 	imgMap, _, err := image.Decode(fMap)
 	if err != nil {
 		return err
@@ -77,19 +100,42 @@ func genHeatmap(points []r2.Point,
 	img := image.NewRGBA(imgMap.Bounds())
 	draw.Draw(img, imgMap.Bounds(), imgMap, image.Point{}, draw.Over)
 
-	// Generate and draw heatmap overlay on top of the overview
-	imgHeatmap := heatmap.Heatmap(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), data, dotSize, opacity, schemes.AlphaFire)
-	draw.Draw(img, bounds, imgHeatmap, image.Point{}, draw.Over)
+	// With no points we will just serve up the plain overview
+	if len(points) != 0 {
+		// Find bounding rectangle for points to get around the normalization done by the heatmap library
+		r2Bounds := r2.RectFromPoints(points...)
+		padding := float64(dotSize) / 2.0 // Calculating padding amount to avoid shrinkage by the heatmap library
+		bounds := image.Rectangle{
+			Min: image.Point{X: int(r2Bounds.X.Lo - padding), Y: int(r2Bounds.Y.Lo - padding)},
+			Max: image.Point{X: int(r2Bounds.X.Hi + padding), Y: int(r2Bounds.Y.Hi + padding)},
+		}
+
+		// Transform r2.Points into heatmap.DataPoints
+		var data []heatmap.DataPoint
+		for _, p := range points {
+			// Invert Y since go-heatmap expects data to be ordered from bottom to top
+			data = append(data, heatmap.P(p.X, p.Y*-1))
+		}
 
-	outf, err := os.OpenFile(outPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		// Generate and draw heatmap overlay on top of the overview
+		imgHeatmap := heatmap.Heatmap(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), data, dotSize, opacity, schemes.AlphaFire)
+		draw.Draw(img, bounds, imgHeatmap, image.Point{}, draw.Over)
+	}
+
+	// Write to a temp file first so that concurrent requests for the same
+	// heatmap never see a half-written image
+	outf, err := os.CreateTemp(filepath.Dir(outPath), ".heatmap-*")
 	if err != nil {
 		return err
 	}
 
+	defer os.Remove(outf.Name())
+
 	err = jpeg.Encode(outf, img, &jpeg.Options{Quality: jpegQuality})
+	outf.Close()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return os.Rename(outf.Name(), outPath)
 }
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"testing"
+
+	r2 "github.com/golang/geo/r2"
+)
+
+func TestFilterHeatmapPoints(t *testing.T) {
+	points := []HeatmapPoint{
+		{X: 1, Y: 1, Player: 1, Side: "CT"},
+		{X: 2, Y: 2, Player: 1, Side: "T"},
+		{X: 3, Y: 3, Player: 2, Side: "CT"},
+		{X: 4, Y: 4, Player: 2, Side: "T"},
+	}
+
+	tests := []struct {
+		player uint64
+		side   string
+		want   []r2.Point
+	}{
+		{0, "", []r2.Point{{X: 1, Y: 1}, {X: 2, Y: 2}, {X: 3, Y: 3}, {X: 4, Y: 4}}},
+		{1, "", []r2.Point{{X: 1, Y: 1}, {X: 2, Y: 2}}},
+		{0, "T", []r2.Point{{X: 2, Y: 2}, {X: 4, Y: 4}}},
+		{2, "CT", []r2.Point{{X: 3, Y: 3}}},
+		{3, "", []r2.Point{}},
+	}
+
+	for _, test := range tests {
+		got := filterHeatmapPoints(points, test.player, test.side)
+		if len(got) != len(test.want) {
+			t.Errorf("player %d side %q: got %v, want %v", test.player, test.side, got, test.want)
+			continue
+		}
+
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("player %d side %q: got %v, want %v", test.player, test.side, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHeatmapFileName(t *testing.T) {
+	tests := []struct {
+		dataSet string
+		player  uint64
+		side    string
+		want    string
+	}{
+		{"shotsFired", 0, "", "shotsFired-0-all.jpg"},
+		{"kills", 76561197960287930, "CT", "kills-76561197960287930-CT.jpg"},
+		{"deaths", 0, "T", "deaths-0-T.jpg"},
+	}
+
+	// Every combination of filters needs its own file in the cache
+	seen := make(map[string]bool)
+	for _, test := range tests {
+		got := getHeatmapFileName(test.dataSet, test.player, test.side)
+		if got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+		if seen[got] {
+			t.Errorf("%q is used for more than one heatmap", got)
+		}
+		seen[got] = true
+
+		if !isHeatmapDataset(test.dataSet) {
+			t.Errorf("%q isn't a heatmap dataset", test.dataSet)
+		}
+	}
+
+	if isHeatmapDataset("../../etc/passwd") {
+		t.Error("unknown dataset was accepted")
+	}
+}
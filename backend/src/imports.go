@@ -0,0 +1,304 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+// How often the progress of a download is saved while it's running
+const ImportProgressInterval = time.Second
+
+// The longest an import can take from start to finish, so that a server
+// which trickles the download out slowly can't hold the import forever
+const ImportTimeout = 30 * time.Minute
+
+var (
+	ErrImportTooLarge   = errors.New("demo is larger than the import size limit")
+	ErrImportNoFileName = errors.New("couldn't figure out the demo's file name from the URL")
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zipMagic   = []byte("PK\x03\x04")
+)
+
+var importClient = &http.Client{
+	Timeout: ImportTimeout,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+	},
+}
+
+func isValidImportUrl(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Uses the file name the server gave us if there is one, otherwise
+// the last part of the URL (after following any redirects)
+func getImportFileName(res *http.Response) string {
+	_, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition"))
+	if err == nil && params["filename"] != "" {
+		return path.Base(params["filename"])
+	}
+
+	name := path.Base(res.Request.URL.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
+
+// Counts the bytes downloaded and saves the progress every so often
+type importProgressReader struct {
+	r          io.Reader
+	demoImport *DemoImport
+	maxSize    int64
+	lastSaved  time.Time
+	c          Context
+}
+
+func (p *importProgressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.demoImport.Received += int64(n)
+
+	if p.demoImport.Received > p.maxSize {
+		return n, ErrImportTooLarge
+	}
+
+	if time.Since(p.lastSaved) >= ImportProgressInterval {
+		p.lastSaved = time.Now()
+		saveErr := p.c.db.UpdateDemoImport(*p.demoImport)
+		if saveErr != nil {
+			p.c.logger.Warnf("import=%d failed to save progress: %s", p.demoImport.Id, saveErr.Error())
+		}
+	}
+
+	return n, err
+}
+
+// Returns a reader for the demo inside the download along with the file
+// extension that it should be saved with. The file extension in the URL
+// can't be trusted (e.g. a lot of servers will serve a .dem.gz without the
+// .gz) so this goes by the file's contents
+func decompressDownload(body *bufio.Reader) (io.Reader, string, error) {
+	magic, err := body.Peek(len(zipMagic))
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, "", err
+		}
+		return gr, ".dem", nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return bzip2.NewReader(body), ".dem", nil
+	case bytes.HasPrefix(magic, zipMagic):
+		return body, ".zip", nil
+	}
+
+	return body, ".dem", nil
+}
+
+// Downloads the demo into a hidden temp file for the upload folder. Gzip and
+// bzip2 compressed demos are decompressed as they're downloaded, zip archives
+// are kept as they are. Returns the path to the temp file and the name that
+// the demo should be saved under
+func downloadDemo(demoImport *DemoImport, c Context) (string, string, error) {
+	res, err := importClient.Get(demoImport.Url)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("server responded with %s", res.Status)
+	}
+
+	maxSize := int64(c.config.importMaxSize) * 1024 * 1024
+	if res.ContentLength > maxSize {
+		return "", "", ErrImportTooLarge
+	} else if res.ContentLength >= 0 {
+		total := res.ContentLength
+		demoImport.Total = &total
+	}
+
+	body := bufio.NewReader(&importProgressReader{
+		r:          res.Body,
+		demoImport: demoImport,
+		maxSize:    maxSize,
+		lastSaved:  time.Now(),
+		c:          c,
+	})
+
+	r, extension, err := decompressDownload(body)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := getImportFileName(res)
+	if name == "" {
+		return "", "", ErrImportNoFileName
+	}
+
+	fileName := getDemoFileName(name) + extension
+	if !isValidUploadName(fileName) {
+		return "", "", fmt.Errorf("invalid file name %s", fileName)
+	}
+
+	err = checkUploadName(fileName, c)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Saved before the download starts so that the
+	// demo ID shows up along with the progress
+	demoImport.DemoId = getDemoFileName(fileName)
+	err = c.db.UpdateDemoImport(*demoImport)
+	if err != nil {
+		return "", "", err
+	}
+
+	tempDir := c.store.TempDir(c.config.uploadPath)
+	err = os.MkdirAll(tempDir, os.ModePerm)
+	if err != nil {
+		return "", "", err
+	}
+
+	tempPath := join(tempDir, fmt.Sprintf(".import-%d.download", demoImport.Id))
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	// Compressed demos can be a lot bigger than the download
+	// so the size limit is checked again after decompressing
+	written, err := io.Copy(f, io.LimitReader(r, maxSize+1))
+	if err == nil && written > maxSize {
+		err = ErrImportTooLarge
+	}
+
+	if err != nil {
+		os.Remove(tempPath)
+		return "", "", err
+	}
+
+	return tempPath, fileName, nil
+}
+
+// Downloads the demo and adds it to the upload folder. If parse is set the
+// demo is queued for parsing straight away, otherwise it's left for the file
+// watcher or the next rescan to pick up (e.g. when importing from the command
+// line while the server is running)
+func runDemoImport(demoImport *DemoImport, parse bool, c Context) error {
+	demoImport.Status = DemoImportDownloading
+	err := c.db.UpdateDemoImport(*demoImport)
+	if err != nil {
+		return err
+	}
+
+	var job *ParseJob
+	tempPath, fileName, err := downloadDemo(demoImport, c)
+	if err == nil && parse {
+		job, err = addDemoFile(tempPath, fileName, c)
+	} else if err == nil {
+		_, err = placeDemoFile(tempPath, fileName, c)
+	}
+
+	if tempPath != "" {
+		removeErr := os.Remove(tempPath)
+		if removeErr != nil && !os.IsNotExist(removeErr) {
+			c.logger.Warnf("import=%d failed to remove temp file: %s", demoImport.Id, removeErr.Error())
+		}
+	}
+
+	if err != nil {
+		demoImport.Status = DemoImportFailed
+		demoImport.Error = err.Error()
+	} else {
+		demoImport.Status = DemoImportDone
+		if job != nil {
+			demoImport.ParseJobId = &job.id
+		}
+	}
+
+	saveErr := c.db.UpdateDemoImport(*demoImport)
+	if saveErr != nil {
+		c.logger.Warnf("import=%d failed to save import: %s", demoImport.Id, saveErr.Error())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	username := ""
+	if demoImport.Username != nil {
+		username = *demoImport.Username
+	}
+
+	c.db.InsertAuditEntry(AuditEntry{
+		System:      username == "",
+		Username:    username,
+		Action:      "DEMO_IMPORTED",
+		Description: fmt.Sprintf("Demo %s was imported from %s", demoImport.DemoId, demoImport.Url),
+	})
+
+	return nil
+}
+
+// Adds a queued import for each URL. The imports still need to be run
+func queueDemoImports(urls []string, username string, c Context) ([]DemoImport, error) {
+	imports := make([]DemoImport, 0, len(urls))
+	for _, u := range urls {
+		id, err := c.db.InsertDemoImport(u, username)
+		if err != nil {
+			return nil, err
+		}
+
+		demoImport, err := c.db.GetDemoImport(id)
+		if err != nil {
+			return nil, err
+		}
+
+		imports = append(imports, *demoImport)
+	}
+
+	return imports, nil
+}
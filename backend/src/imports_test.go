@@ -0,0 +1,173 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newImportServer(t *testing.T) *httptest.Server {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(testDemo))
+	gw.Close()
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, _ := zw.Create("pug_de_vertigo.dem")
+	w.Write([]byte(testDemo))
+	zw.Close()
+
+	bz2, err := hex.DecodeString(testDemoBz2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/demos/pug_de_dust2.dem", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testDemo))
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="pug_de_mirage.dem.gz"`)
+		w.Write(gz.Bytes())
+	})
+	// Served without the extension to make sure it goes by the contents
+	mux.HandleFunc("/demos/pug_de_nuke.dem", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bz2)
+	})
+	mux.HandleFunc("/demos/pug_de_vertigo.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(zipped.Bytes())
+	})
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/demos/pug_de_dust2.dem", http.StatusFound)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestImportDownloads(t *testing.T) {
+	server := newImportServer(t)
+
+	tests := []struct {
+		path      string
+		name      string
+		extension string
+	}{
+		{"/demos/pug_de_dust2.dem", "pug_de_dust2.dem", ".dem"},
+		{"/old", "pug_de_dust2.dem", ".dem"},
+		{"/download", "pug_de_mirage.dem.gz", ".dem"},
+		{"/demos/pug_de_nuke.dem", "pug_de_nuke.dem", ".dem"},
+		{"/demos/pug_de_vertigo.zip", "pug_de_vertigo.zip", ".zip"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			res, err := importClient.Get(server.URL + test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if name := getImportFileName(res); name != test.name {
+				t.Errorf("got file name %q, want %q", name, test.name)
+			}
+
+			r, extension, err := decompressDownload(bufio.NewReader(res.Body))
+			if err != nil {
+				t.Fatalf("decompressDownload: %v", err)
+			}
+
+			if extension != test.extension {
+				t.Errorf("got extension %q, want %q", extension, test.extension)
+			}
+
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if extension == ".zip" {
+				zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+				if err != nil {
+					t.Fatalf("zip was not kept intact: %v", err)
+				}
+
+				f, err := zr.File[0].Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, _ = io.ReadAll(f)
+				f.Close()
+			}
+
+			if string(data) != testDemo {
+				t.Errorf("got contents %q, want %q", data, testDemo)
+			}
+		})
+	}
+}
+
+func TestImportSizeLimit(t *testing.T) {
+	demoImport := &DemoImport{}
+	r := &importProgressReader{
+		r:          strings.NewReader(strings.Repeat("x", 100)),
+		demoImport: demoImport,
+		maxSize:    64,
+		lastSaved:  time.Now(),
+	}
+
+	_, err := io.ReadAll(r)
+	if err != ErrImportTooLarge {
+		t.Fatalf("got error %v, want %v", err, ErrImportTooLarge)
+	}
+
+	if demoImport.Received != 100 {
+		t.Errorf("received %d bytes, want 100", demoImport.Received)
+	}
+}
+
+func TestIsValidImportUrl(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com/pug.dem": true,
+		"http://example.com/pug.dem":  true,
+		"ftp://example.com/pug.dem":   false,
+		"file:///etc/passwd":          false,
+		"https:///pug.dem":            false,
+		"pug.dem":                     false,
+	}
+
+	for u, want := range tests {
+		if got := isValidImportUrl(u); got != want {
+			t.Errorf("isValidImportUrl(%q) = %v, want %v", u, got, want)
+		}
+	}
+}
@@ -38,7 +38,7 @@ const (
 func main() {
 	args := os.Args[1:]
 	if len(args) == 0 {
-		fmt.Println("Commands: parse, serve, migrate, argon")
+		fmt.Println("Commands: parse, serve, migrate, argon, import")
 		return
 	}
 
@@ -77,12 +77,14 @@ func main() {
 		commandServe(context)
 	case "migrate":
 		commandMigrate(args, context)
+	case "import":
+		commandImport(args, context)
 	}
 }
 
 func commandParse(args []string, config Config, logger *Logger) {
 	if len(args) >= 2 && args[1] != "" {
-		output, err := parseDemo(args[1], ".", config, logger)
+		output, err := parseDemo(args[1], config, logger)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return
@@ -95,7 +97,7 @@ func commandParse(args []string, config Config, logger *Logger) {
 			fmt.Println(string(json))
 		}
 	} else {
-		fmt.Fprintln(os.Stderr, "Usage: parse /path/to/demo.dem")
+		fmt.Fprintln(os.Stderr, "Usage: parse /path/to/demo.dem[.gz|.bz2] or /path/to/demo.zip")
 	}
 }
 
@@ -110,6 +112,25 @@ func commandServe(c Context) {
 
 	c.logger.Info("completed database migrations")
 
+	// Anything still queued or running was cut off when
+	// the server last stopped and is never going to finish
+	err = c.db.CleanInterruptedParseJobs()
+	if err != nil {
+		c.logger.Errorf("failed to clean up interrupted parse jobs: %s", err.Error())
+	}
+
+	err = c.db.CleanInterruptedDemoImports()
+	if err != nil {
+		c.logger.Errorf("failed to clean up interrupted imports: %s", err.Error())
+	}
+
+	// The scheduled rescan will do this as well, but it runs in the
+	// background and the routes need to be able to find demos right away
+	_, err = c.demos.scan(c.logger)
+	if err != nil {
+		c.logger.Errorf("failed to search the demo folders: %s", err.Error())
+	}
+
 	scheduler := gocron.NewScheduler(time.UTC)
 	registerJobs(scheduler, c)
 	c.logger.Info("starting job scheduler")
@@ -127,6 +148,49 @@ func commandMigrate(args []string, c Context) {
 	}
 }
 
+// The demos are only downloaded here. The server parses them once it
+// notices them, or on its next rescan if the file watcher is off
+func commandImport(args []string, c Context) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: import <url> [url...]")
+		return
+	}
+
+	for _, u := range args[1:] {
+		if !isValidImportUrl(u) {
+			fmt.Fprintf(os.Stderr, "Error: invalid URL %s\n", u)
+			return
+		}
+	}
+
+	// Needed to check whether the demos are already there
+	_, err := c.demos.scan(c.logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: Failed to search the demo folders")
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	imports, err := queueDemoImports(args[1:], "", c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: Failed to queue imports")
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	for i := range imports {
+		demoImport := &imports[i]
+		fmt.Printf("downloading %s\n", demoImport.Url)
+
+		err := runDemoImport(demoImport, false, c)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to import %s: %s\n", demoImport.Url, err.Error())
+		} else {
+			fmt.Printf("imported %s (%d bytes downloaded)\n", demoImport.DemoId, demoImport.Received)
+		}
+	}
+}
+
 func commandArgon(args []string, logger *Logger) {
 	argon2ID := NewArgon2ID()
 	if len(args) < 2 {
@@ -0,0 +1,214 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// How far apart two demos can be dated and still be
+// automatically merged into the same match
+const AutoMergeWindow = 24 * time.Hour
+
+// Groups the demos into a single match and parses it. The standalone
+// matches for all but the first demo are removed since their rounds
+// are now part of the first demo's match. The demos stay claimed the
+// whole time so that nothing can parse them half way through
+func mergeDemos(demoIds []string, automatic bool, c Context) error {
+	heatmapsDir := join(c.config.dataPath, "heatmaps")
+
+	if !c.coordinator.claimDemos(demoIds) {
+		return ErrParseInProgress
+	}
+	defer func() {
+		for _, demoId := range demoIds {
+			c.coordinator.releaseDemo(demoId)
+		}
+	}()
+
+	err := c.db.MergeMatchParts(demoIds, automatic)
+	if err != nil {
+		return err
+	}
+
+	for _, demoId := range demoIds[1:] {
+		err = clearHeatmapCache(heatmapsDir, demoId)
+		if err != nil {
+			c.logger.Warnf("demo=%s failed to clear heatmap cache: %s", demoId, err.Error())
+		}
+	}
+
+	path, err := c.demos.find(demoIds[0])
+	if err != nil {
+		return err
+	}
+
+	matchId, paths, err := getMatchPaths(path, c)
+	if err != nil {
+		return err
+	}
+
+	job, err := getParseJob(matchId, paths, false, true, c)
+	if err != nil || job == nil {
+		return err
+	}
+
+	return runClaimedParseJob(job, heatmapsDir, c)
+}
+
+// Breaks a merged match back up into its demos and parses each of them
+// as their own match. The demos are remembered as split so that they
+// won't be merged automatically again
+func splitMatch(parts []MatchPart, c Context) error {
+	heatmapsDir := join(c.config.dataPath, "heatmaps")
+
+	for _, part := range parts {
+		err := c.db.SetMatchParts([]string{part.DemoId}, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := c.db.InvalidateMatch(parts[0].MatchId)
+	if err != nil {
+		return err
+	}
+
+	parseErrors := make(ParseErrors)
+	for _, part := range parts {
+		path, err := c.demos.find(part.DemoId)
+		if err == nil {
+			err = parseIdempotent(path, heatmapsDir, false, c)
+		}
+
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to parse split demo: %s", part.DemoId, err.Error())
+			parseErrors[path] = err
+		}
+	}
+
+	if len(parseErrors) > 0 {
+		return parseErrors
+	}
+
+	return nil
+}
+
+// Looks for matches which pick up part way through (e.g. after a server
+// crash) and merges them into the match they carry on from
+func autoMergeDemos(c Context) {
+	if !c.config.autoMergeDemos {
+		return
+	}
+
+	continuations, err := c.db.GetUnmergedContinuations()
+	if err != nil {
+		c.logger.Errorf("failed to fetch matches to merge: %s", err.Error())
+		return
+	}
+
+	for _, continuation := range continuations {
+		previous, err := findPreviousPart(continuation, c)
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to look for previous part: %s", continuation.Id, err.Error())
+			continue
+		}
+
+		if previous == nil {
+			continue
+		}
+
+		parts, err := c.db.GetMatchParts(previous.Id)
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to fetch match parts: %s", previous.Id, err.Error())
+			continue
+		}
+
+		demoIds := make([]string, 0, len(parts)+1)
+		for _, part := range parts {
+			demoIds = append(demoIds, part.DemoId)
+		}
+
+		if len(demoIds) == 0 {
+			demoIds = append(demoIds, previous.Id)
+		}
+
+		demoIds = append(demoIds, continuation.Id)
+
+		c.logger.Infof("demo=%s merging into match %s", continuation.Id, demoIds[0])
+		err = mergeDemos(demoIds, true, c)
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to merge demo: %s", continuation.Id, err.Error())
+			continue
+		}
+
+		c.db.InsertAuditEntry(AuditEntry{
+			System:      true,
+			Action:      "MATCH_MERGED",
+			Description: fmt.Sprintf("Demo %s was automatically merged into match %s", continuation.Id, demoIds[0]),
+		})
+	}
+}
+
+// The previous part has to be on the same map, mostly the same players,
+// and its rounds have to reach the round that the continuation starts on
+func findPreviousPart(continuation MatchSpan, c Context) (*MatchSpan, error) {
+	window := AutoMergeWindow.Milliseconds()
+	candidates, err := c.db.GetMatchSpans(
+		continuation.Map,
+		continuation.Date-window,
+		continuation.Date+window,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Id == continuation.Id {
+			continue
+		}
+
+		endRound := candidate.StartRound + candidate.TotalRounds
+		continuous := candidate.StartRound < continuation.StartRound && continuation.StartRound <= endRound
+		if continuous && sharesPlayers(candidate.PlayerNames, continuation.PlayerNames) {
+			return &candidate, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// At least half of the players in b also played in a
+func sharesPlayers(a, b NamesMap) bool {
+	if len(b) == 0 {
+		return false
+	}
+
+	shared := 0
+	for player := range b {
+		if _, ok := a[player]; ok {
+			shared += 1
+		}
+	}
+
+	return shared*2 >= len(b)
+}
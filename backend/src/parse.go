@@ -20,40 +20,83 @@
 package main
 
 import (
-	"os"
+	"fmt"
+	"time"
 
-	r2 "github.com/golang/geo/r2"
-
-	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/golang/geo/r3"
 	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
-	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
-	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
 )
 
 const (
-	ParserVersion = 2
+	ParserVersion = 13
 )
 
-func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match, error) {
-	f, err := os.Open(path)
+// Everything collected from a single demo file before the
+// stats are computed
+type DemoPart struct {
+	id               string
+	header           DemoHeader
+	rules            DemoRules
+	demoType         string
+	demoTypeSource   string
+	demoTime         time.Time
+	dateSource       string
+	prd              PerRoundData
+	teams            TeamsMap
+	playerNames      NamesMap
+	ctClanTag        string
+	tClanTag         string
+	incompleteReason string
+	tags             []string
+}
+
+// Demos given on the command line are always local files
+func parseDemo(path string, config Config, logger *Logger) (Match, error) {
+	return parseMatch(getDemoFileName(path), []string{path}, LocalDemoStore{}, config, logger)
+}
+
+// Parses a match which may be split across multiple demo files (e.g.
+// because the server crashed and a backup was restored). The paths must
+// be in the order that they were recorded
+func parseMatch(id string, paths []string, store DemoStore, config Config, logger *Logger) (Match, error) {
+	parts := make([]DemoPart, len(paths))
+	for i, path := range paths {
+		part, err := parseDemoPart(store, path, i == len(paths)-1, config, logger)
+		if err != nil {
+			return Match{}, err
+		}
+		parts[i] = part
+	}
+
+	return computeMatch(id, parts, logger), nil
+}
+
+// The earlier parts of a split match usually end part way through a round
+// when the server goes down, so they are always allowed to end early
+func parseDemoPart(store DemoStore, path string, isLastPart bool, config Config, logger *Logger) (DemoPart, error) {
+	f, err := openDemo(store, path)
 	if err != nil {
-		return Match{}, err
+		return DemoPart{}, err
 	}
 
 	defer f.Close()
 
-	p := dem.NewParser(f)
+	p, err := newDemoBackend(f)
+	if err != nil {
+		return DemoPart{}, err
+	}
+
 	defer p.Close()
 
 	header, err := p.ParseHeader()
 	if err != nil {
-		return Match{}, err
+		return DemoPart{}, err
 	}
 
-	mapMetadata := metadata.MapNameToMap[header.MapName]
+	mapMetadata := header.Radar
 	id := getDemoFileName(path)
-	demoType := getDemoType(id)
-	demoTime := getDemoTime(config, logger, id)
+	demoType, demoTypeSource := getDemoType(config, header, path)
+	demoTime, dateSource := getDemoTime(config, logger, store, path, header)
 
 	prd := PerRoundData{}
 
@@ -67,6 +110,7 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 	var bombDefuserTime int64 = 0
 	var roundStartTime int64 = 0
 	var bombExplodeTime int64 = 0
+	var clutch *Clutch
 
 	var ctClanTag string
 	var tClanTag string
@@ -76,11 +120,37 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 	valveMode := demoType == "steam"
 	isLive := !eseaMode && !valveMode
 
+	replaySampleInterval := getReplaySampleInterval(config.replaySampleRate)
+	var lastReplaySample time.Duration = 0
+
+	// Grenades which are currently in the air or popped, keyed by
+	// the projectile's entity ID. Only tracked for one round
+	activeGrenades := make(map[int]*Grenade)
+	activeSmokes := make(map[int]*Grenade)
+
+	// The most recent shot fired by each player, used for accuracy stats
+	lastShots := make(map[uint64]*Shot)
+
 	deathTimes := make(map[uint64]Death)
 	leavers := make(map[uint64]uint64)
-	heatmaps := make(map[string][]r2.Point)
 
-	p.RegisterEventHandler(func(e events.Kill) {
+	addReplayEvent := func(kind string, position r3.Vector, player *DemoPlayer, entityId int) {
+		if len(prd.replays) == 0 || replaySampleInterval == 0 {
+			return
+		}
+
+		replay := &prd.replays[len(prd.replays)-1]
+		replay.Events = append(replay.Events, newReplayEvent(
+			kind,
+			p.CurrentTime().Milliseconds()-roundStartTime,
+			mapMetadata,
+			position,
+			player,
+			entityId,
+		))
+	}
+
+	p.RegisterEventHandler(func(e KillEvent) {
 		if len(prd.kills) == 0 {
 			return
 		}
@@ -89,7 +159,7 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 			prd.deaths[len(prd.deaths)-1][unBotify(e.Victim.SteamID64)] += 1
 		}
 
-		if e.Assister != nil && e.Victim != nil && e.Assister.Team != e.Victim.Team {
+		if e.Assister != nil && e.Victim != nil && e.Assister.Side != e.Victim.Side {
 			if e.AssistedFlash {
 				prd.flashAssists[len(prd.flashAssists)-1][unBotify(e.Assister.SteamID64)] += 1
 			} else {
@@ -97,13 +167,27 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 			}
 		}
 
-		if e.Killer != nil && e.Victim != nil && e.Killer.Team != e.Victim.Team {
+		if e.Killer != nil && e.Victim != nil && e.Killer.Side != e.Victim.Side {
 			prd.kills[len(prd.kills)-1][unBotify(e.Killer.SteamID64)] += 1
 
 			if e.IsHeadshot {
 				prd.headshots[len(prd.headshots)-1][unBotify(e.Killer.SteamID64)] += 1
 			}
 
+			if isGun(e.Weapon) {
+				headshot := 0
+				if e.IsHeadshot {
+					headshot = 1
+				}
+
+				addWeaponStats(
+					prd.weapons[len(prd.weapons)-1],
+					unBotify(e.Killer.SteamID64),
+					getWeaponFileName(e.Weapon.Type),
+					WeaponStats{Kills: 1, Headshots: headshot},
+				)
+			}
+
 			deathTimes[unBotify(e.Victim.SteamID64)] = Death{
 				KilledBy:    unBotify(e.Killer.SteamID64),
 				TimeOfDeath: p.CurrentTime().Seconds(),
@@ -118,6 +202,9 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 				assister = unBotify(e.Assister.SteamID64)
 			}
 
+			attackerX, attackerY := mapMetadata.TranslateScale(e.Killer.Position.X, e.Killer.Position.Y)
+			victimX, victimY := mapMetadata.TranslateScale(e.Victim.Position.X, e.Victim.Position.Y)
+
 			killInfo := Kill{
 				Weapon:            processWeaponName(*e.Weapon),
 				Assister:          assister,
@@ -128,10 +215,26 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 				NoScope:           e.NoScope,
 				ThroughSmoke:      e.ThroughSmoke,
 				PenetratedObjects: e.PenetratedObjects,
-				AttackerLocation:  e.Killer.LastPlaceName(),
-				VictimLocation:    e.Victim.LastPlaceName(),
+				AttackerLocation:  e.Killer.LastPlaceName,
+				VictimLocation:    e.Victim.LastPlaceName,
+				AttackerPosition:  Position{X: attackerX, Y: attackerY},
+				VictimPosition:    Position{X: victimX, Y: victimY},
 			}
 
+			roundHeatmaps := prd.heatmaps[len(prd.heatmaps)-1]
+			roundHeatmaps["kills"] = append(roundHeatmaps["kills"], HeatmapPoint{
+				X:      attackerX,
+				Y:      attackerY,
+				Player: unBotify(e.Killer.SteamID64),
+				Side:   e.Killer.Side,
+			})
+			roundHeatmaps["deaths"] = append(roundHeatmaps["deaths"], HeatmapPoint{
+				X:      victimX,
+				Y:      victimY,
+				Player: unBotify(e.Victim.SteamID64),
+				Side:   e.Victim.Side,
+			})
+
 			if prd.openings[len(prd.openings)-1] == nil {
 				prd.openings[len(prd.openings)-1] = &OpeningKill{
 					Kill:     killInfo,
@@ -154,18 +257,46 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 				}
 			}
 		}
+
+		if e.Victim != nil {
+			addReplayEvent("death", e.Victim.Position, e.Victim, 0)
+		}
+
+		if e.Victim != nil && clutch == nil {
+			clutch = detectClutch(p.GameState(), e.Victim)
+		}
 	})
 
-	p.RegisterEventHandler(func(e events.PlayerFlashed) {
+	p.RegisterEventHandler(func(e PlayerFlashedEvent) {
 		if len(prd.kills) == 0 {
 			return
 		}
 
-		blindMs := e.FlashDuration().Milliseconds()
+		blindMs := e.FlashDuration.Milliseconds()
+
+		if e.Attacker != nil && e.Player != nil {
+			var flash *Grenade
+			if e.ProjectileId != 0 {
+				flash = activeGrenades[e.ProjectileId]
+			}
+
+			// The blind events can come in after the projectile has been destroyed
+			if flash == nil {
+				flash = findDetonatedGrenade(prd.utility[len(prd.utility)-1], unBotify(e.Attacker.SteamID64), common.EqFlash)
+			}
+
+			if flash != nil {
+				flash.Flashed = append(flash.Flashed, FlashedPlayer{
+					Player:     unBotify(e.Player.SteamID64),
+					DurationMs: blindMs,
+					Teammate:   e.Attacker.Side == e.Player.Side,
+				})
+			}
+		}
 
 		// https://counterstrike.fandom.com/wiki/Flashbang
 		if blindMs > 1950 {
-			if e.Attacker.Team == e.Player.Team {
+			if e.Attacker.Side == e.Player.Side {
 				prd.teammatesFlashed[len(prd.teammatesFlashed)-1][unBotify(e.Attacker.SteamID64)] += 1
 			} else {
 				prd.enemiesFlashed[len(prd.enemiesFlashed)-1][unBotify(e.Attacker.SteamID64)] += 1
@@ -173,21 +304,101 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 		}
 	})
 
-	p.RegisterEventHandler(func(e events.BombDefused) {
-		bombDefuser = unBotify(e.Player.SteamID64)
-		bombDefuserTime = p.CurrentTime().Milliseconds() - roundStartTime
+	p.RegisterEventHandler(func(e BombEvent) {
+		switch e.Kind {
+		case BombDefused:
+			bombDefuser = unBotify(e.Player.SteamID64)
+			bombDefuserTime = p.CurrentTime().Milliseconds() - roundStartTime
+		case BombPlanted:
+			bombPlanter = unBotify(e.Player.SteamID64)
+			bombPlanterTime = p.CurrentTime().Milliseconds() - roundStartTime
+		case BombExplode:
+			bombExplodeTime = p.CurrentTime().Milliseconds() - roundStartTime
+		}
+
+		addReplayEvent(string(e.Kind), e.Position, e.Player, 0)
+	})
+
+	p.RegisterEventHandler(func(e GrenadeEvent) {
+		addReplayEvent(string(e.Kind), e.Projectile.Position, e.Projectile.Thrower, e.Projectile.EntityId)
+	})
+
+	detonateGrenade := func(entityId int, position r3.Vector) *Grenade {
+		grenade := activeGrenades[entityId]
+		if grenade == nil || grenade.detonated {
+			return grenade
+		}
+
+		grenade.detonated = true
+		grenade.DetonateTime = p.CurrentTime().Milliseconds() - roundStartTime
+		grenade.DetonatePosition = toRadarPosition(mapMetadata, position)
+		return grenade
+	}
+
+	p.RegisterEventHandler(func(e GrenadeThrowEvent) {
+		if len(prd.utility) == 0 || e.Projectile.Thrower == nil {
+			return
+		}
+
+		thrower := e.Projectile.Thrower
+		grenade := &Grenade{
+			Type:          getGrenadeName(e.Projectile.Type),
+			Thrower:       unBotify(thrower.SteamID64),
+			Side:          thrower.Side,
+			ThrowTime:     p.CurrentTime().Milliseconds() - roundStartTime,
+			ThrowPosition: toRadarPosition(mapMetadata, thrower.Position),
+			Flashed:       make([]FlashedPlayer, 0),
+			equipment:     e.Projectile.Type,
+		}
+
+		activeGrenades[e.Projectile.EntityId] = grenade
+		prd.utility[len(prd.utility)-1] = append(prd.utility[len(prd.utility)-1], grenade)
+	})
+
+	p.RegisterEventHandler(func(e GrenadeEvent) {
+		entityId := e.Projectile.EntityId
+		switch e.Kind {
+		case GrenadeHeExplode, GrenadeFlashExplode, GrenadeDecoyStart:
+			detonateGrenade(entityId, e.Projectile.Position)
+		case GrenadeSmokeStart:
+			smoke := detonateGrenade(entityId, e.Projectile.Position)
+			if smoke != nil {
+				activeSmokes[entityId] = smoke
+			}
+		case GrenadeSmokeExpire:
+			smoke := activeSmokes[entityId]
+			if smoke != nil {
+				smoke.SmokeDurationMs = p.CurrentTime().Milliseconds() - roundStartTime - smoke.DetonateTime
+				delete(activeSmokes, entityId)
+			}
+		}
 	})
 
-	p.RegisterEventHandler(func(e events.BombPlanted) {
-		bombPlanter = unBotify(e.Player.SteamID64)
-		bombPlanterTime = p.CurrentTime().Milliseconds() - roundStartTime
+	// Molotovs and incendiaries don't have a detonation event that we can tie
+	// back to the projectile, so we will use the projectile's final position
+	p.RegisterEventHandler(func(e GrenadeDestroyEvent) {
+		detonateGrenade(e.Projectile.EntityId, e.Projectile.Position)
+		delete(activeGrenades, e.Projectile.EntityId)
 	})
 
-	p.RegisterEventHandler(func(e events.BombExplode) {
-		bombExplodeTime = p.CurrentTime().Milliseconds() - roundStartTime
+	p.RegisterEventHandler(func(e FrameDoneEvent) {
+		if len(prd.replays) == 0 || replaySampleInterval == 0 {
+			return
+		}
+
+		if p.CurrentTime()-lastReplaySample < replaySampleInterval {
+			return
+		}
+
+		lastReplaySample = p.CurrentTime()
+		replay := &prd.replays[len(prd.replays)-1]
+		replay.Frames = append(
+			replay.Frames,
+			sampleReplayFrame(p.GameState(), mapMetadata, p.CurrentTime().Milliseconds()-roundStartTime),
+		)
 	})
 
-	p.RegisterEventHandler(func(e events.WeaponFire) {
+	p.RegisterEventHandler(func(e WeaponFireEvent) {
 		if e.Shooter == nil || prd.flashesThrown == nil {
 			return
 		}
@@ -208,29 +419,59 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 			prd.smokesThrown[len(prd.smokesThrown)-1][unBotify(e.Shooter.SteamID64)] += 1
 		}
 
-		x, y := mapMetadata.TranslateScale(e.Shooter.Position().X, e.Shooter.Position().Y)
-		heatmaps["shotsFired"] = append(heatmaps["shotsFired"], r2.Point{X: x, Y: y})
+		if isGun(e.Weapon) {
+			prd.AddShot(lastShots, unBotify(e.Shooter.SteamID64), e.Weapon.Type, p.CurrentTime().Milliseconds())
+		}
+
+		x, y := mapMetadata.TranslateScale(e.Shooter.Position.X, e.Shooter.Position.Y)
+		prd.heatmaps[len(prd.heatmaps)-1]["shotsFired"] = append(
+			prd.heatmaps[len(prd.heatmaps)-1]["shotsFired"],
+			HeatmapPoint{X: x, Y: y, Player: unBotify(e.Shooter.SteamID64), Side: e.Shooter.Side},
+		)
 	})
 
-	p.RegisterEventHandler(func(e events.PlayerHurt) {
+	p.RegisterEventHandler(func(e PlayerHurtEvent) {
 		if len(prd.damage) == 0 {
 			return
 		}
 
-		if e.Attacker != nil && e.Player != nil && e.Attacker.Team != e.Player.Team {
+		if e.Attacker != nil && e.Player != nil && e.Attacker.Side != e.Player.Side {
 			prd.damage[len(prd.damage)-1][unBotify(e.Attacker.SteamID64)] += e.HealthDamageTaken
 
 			// logger.Debugf("%s <%s> -> %s (%d HP)\n", e.Attacker.Name, e.Weapon, e.Player.Name, e.HealthDamageTaken)
 
+			attacker := unBotify(e.Attacker.SteamID64)
+			switch e.HitGroup {
+			case HitGroupHead:
+				prd.headDamage[len(prd.headDamage)-1][attacker] += e.HealthDamageTaken
+			case HitGroupChest:
+				prd.chestDamage[len(prd.chestDamage)-1][attacker] += e.HealthDamageTaken
+			case HitGroupStomach:
+				prd.stomachDamage[len(prd.stomachDamage)-1][attacker] += e.HealthDamageTaken
+			case HitGroupArm:
+				prd.armDamage[len(prd.armDamage)-1][attacker] += e.HealthDamageTaken
+			case HitGroupLeg:
+				prd.legDamage[len(prd.legDamage)-1][attacker] += e.HealthDamageTaken
+			}
+
+			if isGun(e.Weapon) {
+				prd.AddShotDamage(lastShots, attacker, e.Weapon.Type, e.HealthDamageTaken)
+			}
+
 			if e.Weapon.Type == common.EqHE ||
 				e.Weapon.Type == common.EqMolotov ||
 				e.Weapon.Type == common.EqIncendiary {
 				prd.utilDamage[len(prd.utilDamage)-1][unBotify(e.Attacker.SteamID64)] += e.HealthDamageTaken
+
+				grenade := findDetonatedGrenade(prd.utility[len(prd.utility)-1], unBotify(e.Attacker.SteamID64), e.Weapon.Type)
+				if grenade != nil {
+					grenade.Damage += e.HealthDamageTaken
+				}
 			}
 		}
 	})
 
-	p.RegisterEventHandler(func(e events.MatchStart) {
+	p.RegisterEventHandler(func(e MatchStartEvent) {
 		if prd.isLive == nil {
 			return
 		}
@@ -260,18 +501,64 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 		}
 	})
 
+	// The header is the most reliable source for the demo type so the
+	// server's messages and convars can only override the folder default,
+	// file name rules or the default, and only the first one that's seen
+	// is used. Once the match has gone live the earlier rounds have
+	// already been cropped based on the old type so it's too late to change
+	setDetectedDemoType := func(detected, source string) {
+		if detected == "" || demoTypeSource == DemoTypeSourceHeader ||
+			demoTypeSource == DemoTypeSourceChat || demoTypeSource == DemoTypeSourceConVar {
+			return
+		}
+
+		for _, live := range prd.isLive {
+			if live {
+				return
+			}
+		}
+
+		logger.Infof("demo=%s detected demo type %s from %s", id, detected, source)
+		demoType = detected
+		demoTypeSource = source
+		eseaMode = demoType == "esea"
+		valveMode = demoType == "steam"
+		isLive = !eseaMode && !valveMode
+
+		if len(prd.isLive) > 0 {
+			prd.isLive[len(prd.isLive)-1] = isLive
+		}
+	}
+
+	p.RegisterEventHandler(func(e ChatMessageEvent) {
+		if e.FromServer {
+			setDetectedDemoType(findDemoTypeMarker(e.Text, ServerDemoTypeMarkers), DemoTypeSourceChat)
+		}
+	})
+
+	p.RegisterEventHandler(func(e ConVarsUpdatedEvent) {
+		for name, value := range e.ConVars {
+			setDetectedDemoType(findDemoTypeMarker(name+" "+value, ServerDemoTypeMarkers), DemoTypeSourceConVar)
+		}
+	})
+
 	// Create a new 'round' map in each of the stats arrays
-	p.RegisterEventHandler(func(e events.RoundStart) {
+	p.RegisterEventHandler(func(e RoundStartEvent) {
 		logger.DebugBig("ROUND START")
-		logger.Debugf("CT %d - %d T", p.GameState().TeamCounterTerrorists().Score(), p.GameState().TeamTerrorists().Score())
-		prd.NewRound(isLive)
+		logger.Debugf("CT %d - %d T", p.GameState().Team("CT").Score, p.GameState().Team("T").Score)
+		prd.NewRound(isLive, p.GameState().Team("CT").Score+p.GameState().Team("T").Score)
 
 		bombDefuser = 0
 		bombPlanter = 0
 		roundStartTime = p.CurrentTime().Milliseconds()
+		lastReplaySample = 0
+		activeGrenades = make(map[int]*Grenade)
+		activeSmokes = make(map[int]*Grenade)
+		lastShots = make(map[uint64]*Shot)
 		bombExplodeTime = 0
 		bombPlanterTime = 0
 		bombDefuserTime = 0
+		clutch = nil
 
 		if teams == nil {
 			teams = make(TeamsMap)
@@ -281,17 +568,32 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 			playerNames = make(NamesMap)
 		}
 
-		updatePlayerNames(&p, &playerNames)
-		updateTeams(&p, &teams, &ctClanTag, &tClanTag, leavers)
+		updatePlayerNames(p.GameState(), &playerNames)
+		updateTeams(p.GameState(), &teams, &ctClanTag, &tClanTag, leavers)
+	})
+
+	p.RegisterEventHandler(func(e RoundFreezetimeEndEvent) {
+		if len(prd.economy) == 0 {
+			return
+		}
+
+		prd.economy[len(prd.economy)-1] = RoundEconomy{
+			CT: getTeamEconomy(p.GameState().Team("CT")),
+			T:  getTeamEconomy(p.GameState().Team("T")),
+		}
 	})
 
 	// Update the teams when the side switches
-	p.RegisterEventHandler(func(e events.TeamSideSwitch) {
+	p.RegisterEventHandler(func(e TeamSideSwitchEvent) {
 		logger.DebugBig("SIDE SWITCH")
-		updateTeams(&p, &teams, &ctClanTag, &tClanTag, leavers)
+		if len(prd.sideSwitches) > 0 {
+			prd.sideSwitches[len(prd.sideSwitches)-1] = true
+		}
+
+		updateTeams(p.GameState(), &teams, &ctClanTag, &tClanTag, leavers)
 	})
 
-	p.RegisterEventHandler(func(e events.PlayerDisconnected) {
+	p.RegisterEventHandler(func(e PlayerDisconnectedEvent) {
 		if !e.Player.IsBot && isLive {
 			leaverTeam := teams[e.Player.SteamID64]
 			var teammate uint64
@@ -304,31 +606,29 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 		}
 	})
 
-	p.RegisterEventHandler(func(e events.RoundEnd) {
+	p.RegisterEventHandler(func(e RoundEndEvent) {
 		logger.Debug(e)
-		winner := ""
-
-		switch e.Winner {
-		case common.TeamCounterTerrorists:
-			winner = "CT"
-		case common.TeamTerrorists:
-			winner = "T"
-		}
+		winner := e.Winner
 
 		if len(prd.rounds) == 0 {
 			return
 		}
 
-		updateTeams(&p, &teams, &ctClanTag, &tClanTag, leavers)
+		updateTeams(p.GameState(), &teams, &ctClanTag, &tClanTag, leavers)
+
+		if clutch != nil {
+			clutch.Won = clutch.Side == winner
+		}
 
 		prd.rounds[len(prd.rounds)-1] = Round{
 			Winner:          winner,
-			Reason:          int(e.Reason),
+			Reason:          e.Reason,
 			Planter:         bombPlanter,
 			Defuser:         bombDefuser,
 			PlanterTime:     bombPlanterTime,
 			DefuserTime:     bombDefuserTime,
 			BombExplodeTime: bombExplodeTime,
+			Clutch:          clutch,
 		}
 
 		var roundWinners []uint64
@@ -342,12 +642,19 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 	})
 
 	logger.Infof("demo=%s parsing demo", id)
-	err = p.ParseToEnd()
+	incompleteReason := ""
+	err = parseToEndRecover(p)
 	if err != nil {
-		return Match{}, err
-	}
+		if (isLastPart && !config.recoverPartial) || !hasFinishedRound(prd.rounds) {
+			return DemoPart{}, err
+		}
 
-	logger.Infof("demo=%s computing stats", id)
+		logger.Warnf("demo=%s demo ended early, keeping the rounds that finished: %s", id, err.Error())
+		incompleteReason = err.Error()
+		if prd.rounds[len(prd.rounds)-1].Winner == "" {
+			prd.DropLastRound()
+		}
+	}
 
 	if eseaMode {
 		stripPlayerPrefixes(teams, &playerNames, "CT")
@@ -355,6 +662,77 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 	}
 
 	prd.CropToRealRounds(eseaMode || valveMode)
+
+	return DemoPart{
+		id:               id,
+		header:           header,
+		rules:            p.GameState().Rules(),
+		demoType:         demoType,
+		demoTypeSource:   demoTypeSource,
+		demoTime:         demoTime,
+		dateSource:       dateSource,
+		prd:              prd,
+		teams:            teams,
+		playerNames:      playerNames,
+		ctClanTag:        ctClanTag,
+		tClanTag:         tClanTag,
+		incompleteReason: incompleteReason,
+		tags:             getDemoRoot(config.demoRoots, path).tags,
+	}, nil
+}
+
+// Joins the parts of a match together and computes the stats for it.
+// When one part picks up from an earlier round than the previous part
+// ended on (e.g. a backup from a few rounds back was restored) the
+// replayed rounds are taken from the later part
+func computeMatch(id string, parts []DemoPart, logger *Logger) Match {
+	first := parts[0]
+	last := parts[len(parts)-1]
+
+	prd := first.prd
+	teams := make(TeamsMap)
+	playerNames := make(NamesMap)
+	ctClanTag := ""
+	tClanTag := ""
+	rules := DemoRules{}
+	tags := make([]string, 0)
+	seenTags := make(map[string]bool)
+
+	for i, part := range parts {
+		if i > 0 {
+			prd.Continue(&part.prd)
+		}
+
+		for player, team := range part.teams {
+			teams[player] = team
+		}
+
+		for player, name := range part.playerNames {
+			playerNames[player] = name
+		}
+
+		if part.ctClanTag != "" {
+			ctClanTag = part.ctClanTag
+		}
+
+		if part.tClanTag != "" {
+			tClanTag = part.tClanTag
+		}
+
+		if part.rules.MaxRounds != 0 {
+			rules = part.rules
+		}
+
+		for _, tag := range part.tags {
+			if !seenTags[tag] {
+				seenTags[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	logger.Infof("demo=%s computing stats", id)
+
 	totals := prd.ComputeTotals()
 	totalRounds := len(prd.kills)
 
@@ -370,6 +748,13 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 	impact := computeImpact(totalRounds, teams, totals.assists, kpr)
 	k2, k3, k4, k5 := computeMultikills(prd.kills)
 	oKills, oDeaths, oAttempts, oAttemptsPct, oSuccess := computeOpenings(totals.openingKills)
+	clutchAttempts, clutchWins := computeClutches(prd.rounds)
+	accuracy, firstBulletAccuracy := computeAccuracy(
+		totals.shotsFired,
+		totals.shotsHit,
+		totals.firstShotsFired,
+		totals.firstShotsHit,
+	)
 
 	hltv := computeHLTV(
 		totalRounds,
@@ -381,27 +766,18 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 		adr,
 	)
 
-	halfLength := 15
-	teamAScore, _ := getScore(prd.rounds, "CT", 999999999, halfLength)
-	teamBScore, _ := getScore(prd.rounds, "T", 999999999, halfLength)
-
-	teamAScore16round, _ := getScore(prd.rounds, "CT", 999999999, 8)
-	teamBScore16round, _ := getScore(prd.rounds, "T", 999999999, 8)
-
-	// If the sum of scores is 16 or less and neither team got 16-0'd
-	// then it must be a short match
-	if teamAScore+teamBScore <= 16 && teamAScore != 16 && teamBScore != 16 {
-		teamAScore = teamAScore16round
-		teamBScore = teamBScore16round
-		halfLength = 8
-	}
+	halfLength, overtimeHalfLength := computeMatchFormat(rules, prd.sideSwitches, prd.rounds)
+	teamAScore, _ := getScore(prd.rounds, "CT", 999999999, halfLength, overtimeHalfLength)
+	teamBScore, _ := getScore(prd.rounds, "T", 999999999, halfLength, overtimeHalfLength)
 
 	matchData := MatchData{
-		TotalRounds: totalRounds,
-		Teams:       teams,
-		StartTeams:  computeStartSides(teams, prd.rounds, halfLength),
-		Rounds:      prd.rounds,
-		HalfLength:  halfLength,
+		TotalRounds:        totalRounds,
+		Teams:              teams,
+		StartTeams:         computeStartSides(teams, prd.rounds, halfLength, overtimeHalfLength),
+		Rounds:             prd.rounds,
+		HalfLength:         halfLength,
+		OvertimeHalfLength: overtimeHalfLength,
+		StartRound:         prd.StartRound(),
 
 		Stats: Stats{
 			Adr:                adr,
@@ -433,6 +809,21 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 			TradeKills:         totals.tradeKills,
 			UtilDamage:         totals.utilDamage,
 
+			HeadDamage:          totals.headDamage,
+			ChestDamage:         totals.chestDamage,
+			StomachDamage:       totals.stomachDamage,
+			ArmDamage:           totals.armDamage,
+			LegDamage:           totals.legDamage,
+			ShotsFired:          totals.shotsFired,
+			ShotsHit:            totals.shotsHit,
+			Accuracy:            accuracy,
+			FirstBulletAccuracy: firstBulletAccuracy,
+
+			Weapons: computeWeaponAccuracy(totals.weapons),
+
+			ClutchAttempts: clutchAttempts,
+			ClutchWins:     clutchWins,
+
 			K2: k2,
 			K3: k3,
 			K4: k4,
@@ -441,26 +832,57 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 
 		HeadToHead:   headToHeadTotal(&prd.headToHead),
 		KillFeed:     prd.headToHead,
-		RoundByRound: computeRoundByRound(prd.rounds, prd.headToHead, halfLength),
+		RoundByRound: computeRoundByRound(prd.rounds, prd.headToHead, halfLength, overtimeHalfLength),
+		Economy:      computeEconomy(prd.economy, halfLength),
+		Utility:      derefGrenadeArray(prd.utility),
 		OpeningKills: totals.openingKills,
 	}
 
 	output := Match{
 		Meta: MetaData{
-			Map:           header.MapName,
+			Map:           first.header.MapName,
 			Id:            id,
-			DateTimestamp: demoTime.UnixMilli(),
-			DemoType:      demoType,
+			DateTimestamp: first.demoTime.UnixMilli(),
+			DemoType:      first.demoType,
 			PlayerNames:   playerNames,
 			TeamAScore:    teamAScore,
 			TeamBScore:    teamBScore,
 			TeamATitle:    getTeamName(ctClanTag, teams, playerNames, hltv, "CT"),
 			TeamBTitle:    getTeamName(tClanTag, teams, playerNames, hltv, "T"),
+
+			DemoTypeSource:   first.demoTypeSource,
+			DateSource:       first.dateSource,
+			Tags:             tags,
+			Incomplete:       last.incompleteReason != "",
+			IncompleteReason: last.incompleteReason,
 		},
 		MatchData: matchData,
-		HeatMaps:  heatmaps,
+		HeatMaps:  totals.heatmaps,
+		Replays:   prd.replays,
 	}
 
 	logger.Infof("demo=%s completed parsing", id)
-	return output, nil
+	return output
+}
+
+// Corrupt demos can make the parser panic part way through. We recover
+// here (rather than only further up) so that the rounds collected before
+// the panic can still be kept when partial recovery is enabled
+func parseToEndRecover(p DemoBackend) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parser panicked: %v", r)
+		}
+	}()
+
+	return p.ParseToEnd()
+}
+
+func hasFinishedRound(rounds []Round) bool {
+	for _, round := range rounds {
+		if round.Winner != "" {
+			return true
+		}
+	}
+	return false
 }
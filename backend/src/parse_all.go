@@ -20,27 +20,132 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"sync"
+	"time"
 )
 
-func parseIdempotent(path, heatmapsDir string, shouldRestore bool, c Context) error {
+// How many parsed matches to save to the database at once
+// during a full rescan
+const UpsertBatchSize = 10
+
+// The wait between parse attempts stops doubling once it gets this long
+const MaxParseRetryBackoff = 7 * 24 * time.Hour
+
+type ParseJob struct {
+	// The ID of the job's row in the parse_jobs table
+	id   int
+	path string
+	// All of the demo files that make up the match. Only
+	// has more than one entry for merged matches
+	paths  []string
+	demoId string
+	// What the first demo file looked like when the job was created.
+	// The content hash is only filled in once the job starts running
+	file DemoFileInfo
+	// The file info stored for the match, set when the demo's size or
+	// modification time no longer matches it. The demo is only reparsed
+	// if its contents turn out to be different
+	previousFile *DemoFileInfo
+	// Set for demos without a match, which could turn out to be a
+	// renamed or copied demo once they have been hashed
+	isNew  bool
+	action string
+	format string
+}
+
+type ParseResult struct {
+	job   *ParseJob
+	match Match
+	err   error
+	// Set if the demo didn't need to be parsed after all
+	skipped bool
+}
+
+// Per-file errors from a full rescan, keyed by demo path
+type ParseErrors map[string]error
+
+func (e ParseErrors) Error() string {
+	return fmt.Sprintf("failed to parse %d demo(s)", len(e))
+}
+
+// Returns the ID of the match that the demo belongs to, along with
+// the paths to all of the demo files which make up that match
+func getMatchPaths(path string, c Context) (string, []string, error) {
 	demoId := getDemoFileName(path)
+	parts, err := c.db.GetMatchParts(demoId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(parts) < 2 {
+		return demoId, []string{path}, nil
+	}
+
+	paths := make([]string, len(parts))
+	for i, part := range parts {
+		paths[i], err = c.demos.find(part.DemoId)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	return parts[0].MatchId, paths, nil
+}
+
+// Claims the match that the demo belongs to and returns its parse job. The
+// returned ID has to be released once the job is done. Returns a nil job
+// (and claims nothing) if the match doesn't need to be parsed
+func claimParseJob(path string, shouldRestore, force bool, c Context) (*ParseJob, string, error) {
+	demoId, paths, err := getMatchPaths(path, c)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !c.coordinator.claimDemo(demoId) {
+		return nil, "", ErrParseInProgress
+	}
+
+	job, err := getParseJob(demoId, paths, shouldRestore, force, c)
+	if err != nil || job == nil {
+		c.coordinator.releaseDemo(demoId)
+		return nil, "", err
+	}
+
+	return job, demoId, nil
+}
+
+// Returns a nil job if the demo doesn't need to be parsed. Demos which
+// have failed recently are skipped until their backoff period is over
+// unless force is set. Only cheap checks are done here since demos are
+// claimed one at a time during a rescan, anything which needs the demo
+// to be hashed is left to checkDemoContents on the parse worker
+func getParseJob(demoId string, paths []string, shouldRestore, force bool, c Context) (*ParseJob, error) {
 	alreadyParsed, version, err := c.db.HasMatch(demoId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	format := "New match added from demo %s with parser version %d"
 	action := "MATCH_ADDED"
+	var previousFile *DemoFileInfo
 
 	deleted := alreadyParsed && version == 0
 	upToDate := alreadyParsed && version == ParserVersion
 	outOfDate := alreadyParsed && version != ParserVersion && !deleted
 
-	if upToDate || (deleted && !shouldRestore) {
-		return nil
+	if deleted && !shouldRestore {
+		return nil, nil
+	} else if upToDate {
+		previousFile, err = getChangedDemoFileInfo(demoId, paths[0], c)
+		if err != nil || previousFile == nil {
+			return nil, err
+		}
+
+		format = "Demo %s changed on disk and was reparsed with parser version %d"
+		action = "MATCH_REPARSED"
 	} else if outOfDate {
 		format = "Demo %s updated to new parser version %d"
 		action = "MATCH_UPDATED"
@@ -49,44 +154,716 @@ func parseIdempotent(path, heatmapsDir string, shouldRestore bool, c Context) er
 		action = "MATCH_RESTORED"
 	}
 
-	output, err := parseDemo(path, heatmapsDir, c.config, c.logger)
+	if !force {
+		failure, err := c.db.GetParseFailure(demoId)
+		if err != nil {
+			return nil, err
+		}
+
+		if failure != nil && !canRetryParse(*failure, time.Now()) {
+			return nil, nil
+		}
+	}
+
+	if !alreadyParsed {
+		knownDuplicate, err := isKnownDuplicate(demoId, paths[0], c)
+		if err != nil || knownDuplicate {
+			return nil, err
+		}
+	}
+
+	info, err := c.store.Stat(paths[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &ParseJob{
+		path:   paths[0],
+		paths:  paths,
+		demoId: demoId,
+		file: DemoFileInfo{
+			Size:    info.Size,
+			ModTime: info.ModTime.UnixMilli(),
+		},
+		previousFile: previousFile,
+		isNew:        !alreadyParsed,
+		action:       action,
+		format:       format,
+	}, nil
+}
+
+// Checks whether a demo that has already been parsed might have been
+// overwritten with a different demo. Returns the stored file info if the
+// size or modification time have changed, or nil if they haven't
+func getChangedDemoFileInfo(demoId, path string, c Context) (*DemoFileInfo, error) {
+	stored, err := c.db.GetDemoFileInfo(demoId)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+
+	info, err := c.store.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size == stored.Size && info.ModTime.UnixMilli() == stored.ModTime {
+		return nil, nil
+	}
+
+	return stored, nil
+}
+
+// Hashes the demo and checks whether it actually needs to be parsed.
+// Returns true if the job was handled without parsing the demo
+func checkDemoContents(job *ParseJob, c Context) (bool, error) {
+	hash, err := hashDemo(c.store, job.path)
+	if err != nil {
+		return false, err
+	}
+	job.file.ContentHash = hash
+
+	if job.isNew {
+		return reconnectDemo(job.demoId, hash, c)
+	}
+
+	// Matches parsed before the hash was stored can't be compared so
+	// the current file is assumed to be the one that was parsed
+	stored := job.previousFile
+	if stored != nil && (stored.ContentHash == "" || stored.ContentHash == hash) {
+		// The file was only touched (or copied over with the same contents)
+		return true, c.db.SetDemoFileInfo(job.demoId, job.file)
+	}
+
+	return false, nil
+}
+
+// Demos which were already found to be duplicates aren't hashed again
+// unless they have been modified since, or the demo they are a copy of
+// has gone away (in which case the demo might now be the only copy)
+func isKnownDuplicate(demoId, path string, c Context) (bool, error) {
+	duplicate, err := c.db.GetDuplicateDemo(demoId)
+	if err != nil || duplicate == nil {
+		return false, err
+	}
+
+	info, err := c.store.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	if info.ModTime.UnixMilli() > duplicate.DetectedAt {
+		return false, nil
+	}
+
+	_, err = c.demos.find(duplicate.MatchId)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Checks whether a demo that doesn't have a match yet has the same contents
+// as one that does. If the existing match's demo file is gone the demo was
+// renamed or moved (and the watcher missed it) so the match is reconnected
+// to it. Otherwise the demo is a copy and is recorded as a duplicate instead
+// of being parsed into a second match. Returns true if the demo was handled
+func reconnectDemo(demoId, hash string, c Context) (bool, error) {
+	matchId, err := c.db.GetMatchIdByHash(hash)
+	if err != nil || matchId == "" || matchId == demoId {
+		return false, err
+	}
+
+	_, err = c.demos.find(matchId)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if os.IsNotExist(err) {
+		// Another worker may be reconnecting a copy of the same demo, in
+		// which case this one is left to the next rescan to find as a copy
+		if !c.coordinator.claimDemo(matchId) {
+			return true, nil
+		}
+		defer c.coordinator.releaseDemo(matchId)
+
+		return true, renameDemo(matchId, demoId, c)
+	}
+
+	isNew, err := c.db.InsertDuplicateDemo(DuplicateDemo{
+		DemoId:      demoId,
+		MatchId:     matchId,
+		ContentHash: hash,
+		DetectedAt:  time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if isNew {
+		c.logger.Warnf("demo=%s match=%s demo is a duplicate, skipping", demoId, matchId)
+		c.db.InsertAuditEntry(AuditEntry{
+			System:      true,
+			Action:      "DEMO_DUPLICATE",
+			Description: fmt.Sprintf("Demo %s is a copy of match %s and was not parsed", demoId, matchId),
+		})
+	}
+
+	return true, nil
+}
+
+// Moves the match over to the demo's new name. Does nothing if the match
+// was already moved (e.g. if a rescan got to it before the file watcher).
+// The later parts of a merged match don't have a match of their own, only
+// their match_parts rows, which still need to follow the file
+func renameDemo(oldId, newId string, c Context) error {
+	exists, _, err := c.db.HasMatch(oldId)
+	if err != nil {
+		return err
+	}
+
+	parts, err := c.db.GetMatchParts(oldId)
 	if err != nil {
 		return err
-	} else {
-		err := c.db.UpsertMatches(output)
+	}
+
+	if !exists && len(parts) == 0 {
+		return nil
+	}
+
+	err = c.db.RenameMatch(oldId, newId)
+	if err != nil {
+		return err
+	}
+
+	err = c.db.ClearDuplicateDemo(newId)
+	if err != nil {
+		c.logger.Warnf("demo=%s failed to clear duplicate record: %s", newId, err.Error())
+	}
+
+	err = clearHeatmapCache(join(c.config.dataPath, "heatmaps"), oldId)
+	if err != nil {
+		c.logger.Warnf("demo=%s failed to clear heatmap cache: %s", oldId, err.Error())
+	}
+
+	c.logger.Infof("demo=%s newName=%s renamed demo", oldId, newId)
+	c.db.InsertAuditEntry(AuditEntry{
+		System:      true,
+		Action:      "MATCH_RENAMED",
+		Description: fmt.Sprintf("Match %s was renamed to %s", oldId, newId),
+	})
+
+	return nil
+}
+
+// Records the job in the parse_jobs table so that its progress can be
+// followed through the API. A rescanId of 0 means the job isn't part of
+// a rescan (e.g. it was picked up by the file watcher)
+func queueParseJob(job *ParseJob, rescanId int, c Context) error {
+	id, err := c.db.InsertParseJob(job.demoId, job.path, rescanId)
+	if err != nil {
+		return err
+	}
+
+	job.id = id
+	return nil
+}
+
+func setParseJobStatus(job *ParseJob, status string, jobErr error, c Context) {
+	errorMessage := ""
+	if jobErr != nil {
+		errorMessage = jobErr.Error()
+	}
+
+	err := c.db.UpdateParseJob(job.id, status, errorMessage)
+	if err != nil {
+		c.logger.Warnf("demo=%s job=%d failed to update parse job status: %s", job.demoId, job.id, err.Error())
+	}
+}
+
+func canRetryParse(failure ParseFailure, now time.Time) bool {
+	return failure.NextRetryAt != nil && now.UnixMilli() >= *failure.NextRetryAt
+}
+
+// Works out the failure record after another failed attempt. The wait
+// doubles after each failed attempt (up to MaxParseRetryBackoff, unless
+// the configured backoff is already longer) until the demo runs out of
+// attempts, at which point NextRetryAt is left nil. CS2 demos are never retried
+// since they will keep failing until the build can read them
+func nextParseFailure(job *ParseJob, parseErr error, previous *ParseFailure, now time.Time, config Config) ParseFailure {
+	failure := ParseFailure{
+		DemoId:        job.demoId,
+		Path:          job.path,
+		Error:         parseErr.Error(),
+		Attempts:      1,
+		FirstFailedAt: now.UnixMilli(),
+		LastFailedAt:  now.UnixMilli(),
+	}
+
+	if previous != nil {
+		failure.Attempts = previous.Attempts + 1
+		failure.FirstFailedAt = previous.FirstFailedAt
+	}
+
+	if failure.Attempts < config.parseMaxAttempts && !errors.Is(parseErr, ErrCS2Unsupported) {
+		backoff := time.Duration(config.parseRetryBackoff) * time.Minute
+		limit := MaxParseRetryBackoff
+		if backoff > limit {
+			limit = backoff
+		}
+
+		for i := 1; i < failure.Attempts; i++ {
+			if backoff*2 > limit {
+				backoff = limit
+				break
+			}
+			backoff *= 2
+		}
+
+		nextRetry := now.Add(backoff).UnixMilli()
+		failure.NextRetryAt = &nextRetry
+	}
+
+	return failure
+}
+
+// Stores the failure along with when the demo should next be tried. Once
+// the demo runs out of attempts it will only be retried by an admin
+func recordParseFailure(job *ParseJob, parseErr error, c Context) {
+	previous, err := c.db.GetParseFailure(job.demoId)
+	if err != nil {
+		c.logger.Warnf("demo=%s failed to fetch previous parse failure: %s", job.demoId, err.Error())
+	}
+
+	failure := nextParseFailure(job, parseErr, previous, time.Now(), c.config)
+
+	action := "PARSE_FAILED"
+	description := fmt.Sprintf(
+		"Demo %s failed to parse (attempt %d of %d): %s",
+		job.demoId,
+		failure.Attempts,
+		c.config.parseMaxAttempts,
+		failure.Error,
+	)
+
+	if failure.NextRetryAt == nil {
+		action = "PARSE_QUARANTINED"
+		description = fmt.Sprintf(
+			"Demo %s failed to parse %d times and will not be retried automatically: %s",
+			job.demoId,
+			failure.Attempts,
+			failure.Error,
+		)
+	}
+
+	err = c.db.UpsertParseFailure(failure)
+	if err != nil {
+		c.logger.Warnf("demo=%s failed to record parse failure: %s", job.demoId, err.Error())
+	}
+
+	c.db.InsertAuditEntry(AuditEntry{
+		System:      true,
+		Action:      action,
+		Description: description,
+	})
+}
+
+// Flags the match of a demo which was removed from the demos folder, or
+// marks it as deleted depending on the config
+func removeDemo(path string, c Context) error {
+	c.demos.remove(path)
+	demoId := getDemoFileName(path)
+
+	// A demo with the same name somewhere else is the one being used
+	if _, err := c.demos.find(demoId); err == nil {
+		return nil
+	}
+
+	return handleMissingDemo(demoId, c)
+}
+
+func handleMissingDemo(demoId string, c Context) error {
+	matchId := demoId
+	parts, err := c.db.GetMatchParts(demoId)
+	if err != nil {
+		return err
+	}
+
+	if len(parts) > 1 {
+		matchId = parts[0].MatchId
+	}
+
+	exists, version, err := c.db.HasMatch(matchId)
+	if err != nil || !exists || version == 0 {
+		return err
+	}
+
+	if c.config.removedDemoAction == "delete" {
+		err = c.db.SoftDeleteMatch(matchId)
 		if err != nil {
 			return err
 		}
 
 		c.db.InsertAuditEntry(AuditEntry{
 			System:      true,
-			Action:      action,
-			Description: fmt.Sprintf(format, demoId, ParserVersion),
+			Action:      "MATCH_DELETED",
+			Description: fmt.Sprintf("Match %s was marked as deleted because demo %s was removed", matchId, demoId),
 		})
+		return nil
 	}
 
+	flagged, err := c.db.SetDemoMissing(matchId, true)
+	if err != nil || !flagged {
+		return err
+	}
+
+	c.db.InsertAuditEntry(AuditEntry{
+		System:      true,
+		Action:      "DEMO_REMOVED",
+		Description: fmt.Sprintf("Demo %s was removed, match %s has been flagged as missing its demo", demoId, matchId),
+	})
 	return nil
 }
 
-func parseAllIdempotent(inDir, outDir string, c Context) error {
-	files, err := filepath.Glob(inDir + "/*.dem")
+// Flags the matches of any demos that have gone missing without the file
+// watcher noticing (e.g. they were deleted while the server was down)
+func flagMissingDemos(demoIds []string, c Context) {
+	// An unmounted network share looks just like an empty folder, and
+	// flagging (or deleting) every match because of that would be bad
+	if len(demoIds) == 0 {
+		c.logger.Warnf("no demos were found, skipping the check for missing demos")
+		return
+	}
+
+	missing, err := c.db.GetMissingDemoIds(demoIds)
 	if err != nil {
+		c.logger.Warnf("failed to check for missing demos: %s", err.Error())
+		return
+	}
+
+	for _, demoId := range missing {
+		c.logger.Infof("demo=%s demo is missing from the demos folder", demoId)
+		err = handleMissingDemo(demoId, c)
+		if err != nil {
+			c.logger.Warnf("demo=%s failed to handle missing demo: %s", demoId, err.Error())
+		}
+	}
+}
+
+// Unflags the matches of any of the demos that had been removed
+// but have now shown up in the demos folder again
+func unflagMissingDemos(demoIds []string, c Context) {
+	unflagged, err := c.db.ClearDemosMissing(demoIds)
+	if err != nil {
+		c.logger.Warnf("failed to unflag matches with missing demos: %s", err.Error())
+		return
+	}
+
+	for _, matchId := range unflagged {
+		c.db.InsertAuditEntry(AuditEntry{
+			System:      true,
+			Action:      "DEMO_RETURNED",
+			Description: fmt.Sprintf("Demo for match %s is back in the demos folder", matchId),
+		})
+	}
+}
+
+// demoinfocs will panic on some corrupt or truncated demos. We don't want
+// one bad file to take down a parse worker (or the whole server) so the
+// panic is turned into a regular error and handled like any other failure
+func parseMatchRecover(id string, paths []string, store DemoStore, config Config, logger *Logger) (output Match, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parser panicked: %v", r)
+		}
+	}()
+
+	return parseMatch(id, paths, store, config, logger)
+}
+
+func runParseJob(job *ParseJob, c Context) ParseResult {
+	setParseJobStatus(job, ParseJobRunning, nil, c)
+
+	skipped, err := checkDemoContents(job, c)
+	if err != nil {
+		setParseJobStatus(job, ParseJobFailed, err, c)
+		return ParseResult{job: job, err: err}
+	} else if skipped {
+		setParseJobStatus(job, ParseJobDone, nil, c)
+		return ParseResult{job: job, skipped: true}
+	}
+
+	output, err := parseMatchRecover(job.demoId, job.paths, c.store, c.config, c.logger)
+	if err != nil {
+		setParseJobStatus(job, ParseJobFailed, err, c)
+		recordParseFailure(job, err, c)
+	}
+
+	output.Meta.ContentHash = job.file.ContentHash
+	output.DemoFile = job.file
+
+	// The replays are saved straight away instead of waiting in a batch
+	// with the rest of the match, since they are most of its size
+	if err == nil {
+		err = c.db.UpsertMatchReplays(output.Meta.Id, output.Replays)
+		if err != nil {
+			setParseJobStatus(job, ParseJobFailed, err, c)
+		}
+		output.Replays = nil
+	}
+
+	if err == nil {
+		sourceUrl, sourceErr := c.db.GetDemoSourceUrl(job.demoId)
+		if sourceErr != nil {
+			c.logger.Warnf("demo=%s failed to get demo source: %s", job.demoId, sourceErr.Error())
+		}
+		output.Meta.SourceUrl = sourceUrl
+	}
+
+	return ParseResult{job: job, match: output, err: err}
+}
+
+// Saves all of the parsed matches in one go and writes the audit entries for them
+func saveParseResults(results []ParseResult, heatmapsDir string, c Context) error {
+	matches := make([]Match, len(results))
+	for i, result := range results {
+		matches[i] = result.match
+	}
+
+	err := c.db.UpsertMatches(matches...)
+	if err != nil {
+		for _, result := range results {
+			setParseJobStatus(result.job, ParseJobFailed, err, c)
+		}
 		return err
 	}
 
+	for _, result := range results {
+		setParseJobStatus(result.job, ParseJobDone, nil, c)
+
+		err = c.db.ClearParseFailure(result.job.demoId)
+		if err != nil {
+			c.logger.Warnf("demo=%s failed to clear parse failure: %s", result.job.demoId, err.Error())
+		}
+
+		// Any heatmaps rendered from the old data are now stale
+		err = clearHeatmapCache(heatmapsDir, result.job.demoId)
+		if err != nil {
+			c.logger.Warnf("demo=%s failed to clear heatmap cache: %s", result.job.demoId, err.Error())
+		}
+
+		c.db.InsertAuditEntry(AuditEntry{
+			System:      true,
+			Action:      result.job.action,
+			Description: fmt.Sprintf(result.job.format, result.job.demoId, ParserVersion),
+		})
+	}
+
+	return nil
+}
+
+// Single demos are only parsed in response to a file event or an admin
+// action, so they always skip the retry backoff
+func parseIdempotent(path, heatmapsDir string, shouldRestore bool, c Context) error {
+	job, claimedId, err := claimParseJob(path, shouldRestore, true, c)
+	if err != nil || job == nil {
+		return err
+	}
+	defer c.coordinator.releaseDemo(claimedId)
+
+	return runClaimedParseJob(job, heatmapsDir, c)
+}
+
+// Parses and saves the match right away. The caller has to hold the claim
+func runClaimedParseJob(job *ParseJob, heatmapsDir string, c Context) error {
+	err := queueParseJob(job, 0, c)
+	if err != nil {
+		return err
+	}
+
+	result := runParseJob(job, c)
+	if result.err != nil || result.skipped {
+		return result.err
+	}
+
+	return saveParseResults([]ParseResult{result}, heatmapsDir, c)
+}
+
+func parseAllIdempotent(outDir, trigger string, c Context) error {
+	files, err := c.demos.scan(c.logger)
+	if err != nil {
+		return err
+	}
+
+	demoIds := make([]string, len(files))
+	for i, file := range files {
+		demoIds[i] = getDemoFileName(file)
+	}
+	unflagMissingDemos(demoIds, c)
+	flagMissingDemos(demoIds, c)
+
 	err = os.MkdirAll(join(outDir, "/heatmaps"), os.ModePerm)
 	if err != nil {
 		return err
 	}
 
-	heatmapsDir := join(outDir, "heatmaps")
+	return parseManyIdempotent(files, join(outDir, "heatmaps"), trigger, false, c)
+}
+
+// Parses all of the given demos which are missing or out of date using the
+// worker pool. The run is recorded as a rescan along with one parse job for
+// each demo that needed parsing. Set force to ignore the retry backoff of
+// previously failed demos
+func parseManyIdempotent(files []string, heatmapsDir, trigger string, force bool, c Context) error {
+	rescanId, err := c.db.InsertRescan(trigger)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := c.db.FinishRescan(rescanId)
+		if err != nil {
+			c.logger.Warnf("rescan=%d failed to mark rescan as finished: %s", rescanId, err.Error())
+		}
+	}()
+
+	start := time.Now()
+	parseErrors := make(ParseErrors)
+	jobs := make([]*ParseJob, 0)
+	skipped := 0
 
+	// The demos stay claimed until the whole rescan is finished so
+	// that nothing else can parse them while their results are
+	// waiting in a batch to be saved
+	claimed := make([]string, 0)
+	defer func() {
+		for _, demoId := range claimed {
+			c.coordinator.releaseDemo(demoId)
+		}
+	}()
+
+	// Queue everything up front so that the rescan's progress
+	// can be reported against the total number of jobs
 	for _, file := range files {
-		err = parseIdempotent(file, heatmapsDir, false, c)
+		job, claimedId, err := claimParseJob(file, false, force, c)
+		if err == ErrParseInProgress {
+			c.logger.Debugf("demo=%s already being parsed, skipping", getDemoFileName(file))
+			skipped += 1
+			continue
+		}
+
+		if claimedId != "" {
+			claimed = append(claimed, claimedId)
+		}
+
+		if err == nil && job != nil {
+			err = queueParseJob(job, rescanId, c)
+		}
+
 		if err != nil {
-			return err
+			c.logger.Errorf("demo=%s failed to queue demo: %s", getDemoFileName(file), err.Error())
+			parseErrors[file] = err
+		} else if job == nil {
+			skipped += 1
+		} else {
+			jobs = append(jobs, job)
 		}
 	}
 
+	err = c.db.SetRescanTotal(rescanId, len(jobs))
+	if err != nil {
+		c.logger.Warnf("rescan=%d failed to set rescan total: %s", rescanId, err.Error())
+	}
+
+	numWorkers := c.config.parseWorkers
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	queue := make(chan *ParseJob)
+	results := make(chan ParseResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				results <- runParseJob(job, c)
+			}
+		}()
+	}
+
+	go func() {
+		for _, job := range jobs {
+			queue <- job
+		}
+		close(queue)
+		wg.Wait()
+		close(results)
+	}()
+
+	batch := make([]ParseResult, 0, UpsertBatchSize)
+	parsed := 0
+
+	saveBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		err := saveParseResults(batch, heatmapsDir, c)
+		for _, result := range batch {
+			if err != nil {
+				c.logger.Errorf("demo=%s failed to save match: %s", result.job.demoId, err.Error())
+				parseErrors[result.job.path] = err
+			} else {
+				parsed += 1
+			}
+		}
+
+		batch = batch[:0]
+		c.logger.Infof(
+			"rescan=%d progress: %d/%d demos done (%d parsed, %d skipped, %d failed)",
+			rescanId,
+			parsed+skipped+len(parseErrors),
+			len(files),
+			parsed,
+			skipped,
+			len(parseErrors),
+		)
+	}
+
+	for result := range results {
+		if result.err != nil {
+			c.logger.Errorf("demo=%s failed to parse demo: %s", result.job.demoId, result.err.Error())
+			parseErrors[result.job.path] = result.err
+			continue
+		} else if result.skipped {
+			skipped += 1
+			continue
+		}
+
+		batch = append(batch, result)
+		if len(batch) >= UpsertBatchSize {
+			saveBatch()
+		}
+	}
+
+	saveBatch()
+
+	c.logger.Infof(
+		"rescan=%d finished in %s: %d demos found, %d parsed, %d skipped, %d failed",
+		rescanId,
+		time.Since(start).Round(time.Second),
+		len(files),
+		parsed,
+		skipped,
+		len(parseErrors),
+	)
+
+	if len(parseErrors) > 0 {
+		return parseErrors
+	}
+
 	return nil
 }
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseFailureBackoff(t *testing.T) {
+	config := Config{parseMaxAttempts: 4, parseRetryBackoff: 15}
+	job := &ParseJob{demoId: "pug_de_overpass", path: "/demos/pug_de_overpass.dem"}
+	parseErr := errors.New("unexpected EOF")
+
+	start := time.Date(2022, 6, 30, 20, 0, 0, 0, time.UTC)
+	now := start
+	var failure *ParseFailure
+
+	// 15 minutes, then 30, then 60, then no more retries
+	waits := []time.Duration{15 * time.Minute, 30 * time.Minute, time.Hour}
+	for attempt := 1; attempt <= config.parseMaxAttempts; attempt++ {
+		next := nextParseFailure(job, parseErr, failure, now, config)
+		failure = &next
+
+		if failure.Attempts != attempt {
+			t.Fatalf("got attempt %d, want %d", failure.Attempts, attempt)
+		}
+
+		if failure.FirstFailedAt != start.UnixMilli() || failure.LastFailedAt != now.UnixMilli() {
+			t.Errorf("attempt %d: wrong failure times %d, %d", attempt, failure.FirstFailedAt, failure.LastFailedAt)
+		}
+
+		if failure.Error != parseErr.Error() || failure.DemoId != job.demoId || failure.Path != job.path {
+			t.Errorf("attempt %d: unexpected failure %+v", attempt, failure)
+		}
+
+		if attempt == config.parseMaxAttempts {
+			if failure.NextRetryAt != nil {
+				t.Fatalf("demo is still retried after %d attempts", attempt)
+			}
+
+			// Only an admin can retry it now
+			if canRetryParse(*failure, now.Add(365*24*time.Hour)) {
+				t.Fatal("quarantined demo can be retried")
+			}
+			break
+		}
+
+		wait := waits[attempt-1]
+		if failure.NextRetryAt == nil || *failure.NextRetryAt != now.Add(wait).UnixMilli() {
+			t.Fatalf("attempt %d: got next retry %v, want %s later", attempt, failure.NextRetryAt, wait)
+		}
+
+		if canRetryParse(*failure, now.Add(wait-time.Second)) {
+			t.Errorf("attempt %d: demo can be retried before its backoff is over", attempt)
+		}
+
+		now = now.Add(wait)
+		if !canRetryParse(*failure, now) {
+			t.Errorf("attempt %d: demo can't be retried once its backoff is over", attempt)
+		}
+	}
+}
+
+func TestParseFailureBackoffLimit(t *testing.T) {
+	now := time.Now()
+	job := &ParseJob{demoId: "pug_de_overpass"}
+	parseErr := errors.New("unexpected EOF")
+
+	tests := []struct {
+		backoff  int
+		attempts int
+		want     time.Duration
+	}{
+		{60, 8, 128 * time.Hour},
+		{60, 9, MaxParseRetryBackoff},
+		// Would overflow without the limit
+		{60, 80, MaxParseRetryBackoff},
+		{60, 1000, MaxParseRetryBackoff},
+		// Already longer than the limit so it never doubles
+		{14 * 24 * 60, 5, 14 * 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		config := Config{parseMaxAttempts: test.attempts + 1, parseRetryBackoff: test.backoff}
+		previous := &ParseFailure{Attempts: test.attempts - 1, FirstFailedAt: now.UnixMilli()}
+
+		failure := nextParseFailure(job, parseErr, previous, now, config)
+		if failure.NextRetryAt == nil {
+			t.Fatalf("backoff %d, attempt %d: demo won't be retried", test.backoff, test.attempts)
+		}
+
+		if got := time.Duration(*failure.NextRetryAt-now.UnixMilli()) * time.Millisecond; got != test.want {
+			t.Errorf("backoff %d, attempt %d: got wait %s, want %s", test.backoff, test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestParseFailureSingleAttempt(t *testing.T) {
+	config := Config{parseMaxAttempts: 1, parseRetryBackoff: 15}
+	job := &ParseJob{demoId: "pug_de_overpass"}
+
+	failure := nextParseFailure(job, errors.New("bad demo"), nil, time.Now(), config)
+	if failure.NextRetryAt != nil {
+		t.Errorf("demo will be retried with only one attempt allowed")
+	}
+}
+
+func TestParseFailureCS2(t *testing.T) {
+	config := Config{parseMaxAttempts: 4, parseRetryBackoff: 15}
+	job := &ParseJob{demoId: "pug_de_anubis"}
+
+	// Retrying won't help until the build can read CS2 demos
+	failure := nextParseFailure(job, ErrCS2Unsupported, nil, time.Now(), config)
+	if failure.NextRetryAt != nil {
+		t.Errorf("CS2 demo will be retried")
+	}
+}
+
+// Only what checkDemoContents needs, anything else will panic
+type demoFileInfoStorage struct {
+	Storage
+	saved map[string]DemoFileInfo
+}
+
+func (s *demoFileInfoStorage) SetDemoFileInfo(id string, info DemoFileInfo) error {
+	s.saved[id] = info
+	return nil
+}
+
+func TestCheckDemoContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pug_de_overpass.dem")
+	if err := os.WriteFile(path, []byte(testDemo), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hashDemo(LocalDemoStore{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		previous string
+		skipped  bool
+	}{
+		{"only touched", hash, true},
+		{"parsed before hashes were stored", "", true},
+		{"overwritten", "0123456789abcdef", false},
+	}
+
+	for _, test := range tests {
+		db := &demoFileInfoStorage{saved: make(map[string]DemoFileInfo)}
+		c := Context{db: db, store: LocalDemoStore{}}
+		job := &ParseJob{
+			demoId:       "pug_de_overpass",
+			path:         path,
+			file:         DemoFileInfo{Size: int64(len(testDemo)), ModTime: 1000},
+			previousFile: &DemoFileInfo{ContentHash: test.previous, Size: 1, ModTime: 1},
+		}
+
+		skipped, err := checkDemoContents(job, c)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if skipped != test.skipped {
+			t.Errorf("%s: got skipped %v, want %v", test.name, skipped, test.skipped)
+		}
+
+		if job.file.ContentHash != hash {
+			t.Errorf("%s: got hash %q, want %q", test.name, job.file.ContentHash, hash)
+		}
+
+		// The new size and modification time are kept so it isn't hashed again
+		if saved, ok := db.saved[job.demoId]; skipped && (!ok || saved != job.file) {
+			t.Errorf("%s: got saved file info %+v, want %+v", test.name, saved, job.file)
+		} else if !skipped && ok {
+			t.Errorf("%s: file info was saved for a demo that needs parsing", test.name)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrParseInProgress = errors.New("demo is already being parsed")
+
+// Rescans can be started by the cron job, the API and admin retries, and
+// the file watcher parses demos on its own. The coordinator makes sure
+// that only one rescan runs at a time and that a demo is never parsed by
+// two goroutines at once
+type ParseCoordinator struct {
+	mu            sync.Mutex
+	rescanRunning bool
+	rescanTrigger string
+	// A rescan which was requested while another one was running.
+	// It's run as soon as the running one finishes
+	queuedRescan *QueuedRescan
+	inFlight     map[string]bool
+}
+
+type QueuedRescan struct {
+	trigger string
+	run     func()
+}
+
+func newParseCoordinator() *ParseCoordinator {
+	return &ParseCoordinator{
+		inFlight: make(map[string]bool),
+	}
+}
+
+// Runs the rescan in a new goroutine. Returns false without running it if
+// another rescan is already in progress
+func (p *ParseCoordinator) startRescan(trigger string, run func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rescanRunning {
+		return false
+	}
+
+	p.runRescan(trigger, run)
+	return true
+}
+
+// Like startRescan, except that if another rescan is already in progress
+// this one is run again once it finishes, since the running one could have
+// already gone past whatever prompted the request. Only one rescan is kept
+// waiting since a single rescan will pick up everything that was asked
+// for before it started. Returns false if the rescan was queued
+func (p *ParseCoordinator) startOrQueueRescan(trigger string, run func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rescanRunning {
+		p.queuedRescan = &QueuedRescan{trigger: trigger, run: run}
+		return false
+	}
+
+	p.runRescan(trigger, run)
+	return true
+}
+
+// Must be called with the lock held
+func (p *ParseCoordinator) runRescan(trigger string, run func()) {
+	p.rescanRunning = true
+	p.rescanTrigger = trigger
+
+	go func() {
+		for run != nil {
+			run()
+
+			p.mu.Lock()
+			if p.queuedRescan != nil {
+				p.rescanTrigger = p.queuedRescan.trigger
+				run = p.queuedRescan.run
+				p.queuedRescan = nil
+			} else {
+				p.rescanRunning = false
+				p.rescanTrigger = ""
+				run = nil
+			}
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// Returns the trigger of the running rescan, or an empty string if no
+// rescan is running
+func (p *ParseCoordinator) runningRescan() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rescanTrigger
+}
+
+// Claims the demo for parsing. Returns false if someone else is already
+// parsing it. Every successful claim must be released
+func (p *ParseCoordinator) claimDemo(demoId string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inFlight[demoId] {
+		return false
+	}
+
+	p.inFlight[demoId] = true
+	return true
+}
+
+// Claims all of the demos or none of them
+func (p *ParseCoordinator) claimDemos(demoIds []string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, demoId := range demoIds {
+		if p.inFlight[demoId] {
+			return false
+		}
+	}
+
+	for _, demoId := range demoIds {
+		p.inFlight[demoId] = true
+	}
+	return true
+}
+
+func (p *ParseCoordinator) releaseDemo(demoId string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.inFlight, demoId)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueuedRescan(t *testing.T) {
+	p := newParseCoordinator()
+	release := make(chan bool)
+	ran := make(chan string, 10)
+
+	rescan := func(trigger string) func() {
+		return func() {
+			ran <- trigger
+			<-release
+		}
+	}
+
+	if !p.startOrQueueRescan("cron", rescan("cron")) {
+		t.Fatal("rescan wasn't started")
+	}
+	if got := <-ran; got != "cron" {
+		t.Fatalf("got rescan %s, want cron", got)
+	}
+
+	// Both requests come in while the first rescan is running
+	// and only one more rescan should come of them
+	if p.startOrQueueRescan("api", rescan("api")) {
+		t.Fatal("second rescan was started while the first one was running")
+	}
+	if p.startOrQueueRescan("api", rescan("api")) {
+		t.Fatal("third rescan was started while the first one was running")
+	}
+
+	// A retry isn't queued, the caller is told to try again later
+	if p.startRescan("retry", rescan("retry")) {
+		t.Fatal("retry was started while a rescan was running")
+	}
+
+	release <- true
+	if got := <-ran; got != "api" {
+		t.Fatalf("got rescan %s, want api", got)
+	}
+	if got := p.runningRescan(); got != "api" {
+		t.Errorf("got running rescan %q, want api", got)
+	}
+
+	release <- true
+	select {
+	case got := <-ran:
+		t.Fatalf("rescan %s ran after the queued one", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if got := p.runningRescan(); got != "" {
+		t.Errorf("got running rescan %q after everything finished", got)
+	}
+
+	if !p.startOrQueueRescan("cron", func() {}) {
+		t.Error("rescan wasn't started after the others finished")
+	}
+}
@@ -19,6 +19,8 @@
 
 package main
 
+import "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+
 type OpeningKill struct {
 	Kill     Kill   `json:"kill"`
 	Attacker uint64 `json:"attacker,string"`
@@ -37,6 +39,16 @@ type PerRoundData struct {
 	enemiesFlashed   []PlayerIntMap
 	teammatesFlashed []PlayerIntMap
 	utilDamage       []PlayerIntMap
+	weapons          []PlayerWeaponMap
+	headDamage       []PlayerIntMap
+	chestDamage      []PlayerIntMap
+	stomachDamage    []PlayerIntMap
+	armDamage        []PlayerIntMap
+	legDamage        []PlayerIntMap
+	shotsFired       []PlayerIntMap
+	shotsHit         []PlayerIntMap
+	firstShotsFired  []PlayerIntMap
+	firstShotsHit    []PlayerIntMap
 	openings         []*OpeningKill
 
 	flashesThrown []PlayerIntMap
@@ -45,9 +57,19 @@ type PerRoundData struct {
 	smokesThrown  []PlayerIntMap
 
 	headToHead []map[uint64]map[uint64]Kill
+	utility    [][]*Grenade
+	heatmaps   []HeatmapData
+	replays    []RoundReplay
 
 	rounds  []Round
 	winners [][]uint64
+	economy []RoundEconomy
+
+	// Whether the teams switched sides after the round ended
+	sideSwitches []bool
+	// How many rounds had been played according to the game's
+	// scoreboard when the round started
+	roundsPlayed []int
 
 	isLive []bool
 }
@@ -68,10 +90,21 @@ type Totals struct {
 	hEsThrown        PlayerIntMap
 	molliesThrown    PlayerIntMap
 	smokesThrown     PlayerIntMap
+	weapons          PlayerWeaponMap
+	headDamage       PlayerIntMap
+	chestDamage      PlayerIntMap
+	stomachDamage    PlayerIntMap
+	armDamage        PlayerIntMap
+	legDamage        PlayerIntMap
+	shotsFired       PlayerIntMap
+	shotsHit         PlayerIntMap
+	firstShotsFired  PlayerIntMap
+	firstShotsHit    PlayerIntMap
 	openingKills     []OpeningKill
+	heatmaps         HeatmapData
 }
 
-func (prd *PerRoundData) NewRound(isLive bool) {
+func (prd *PerRoundData) NewRound(isLive bool, roundsPlayed int) {
 	prd.kills = append(prd.kills, make(PlayerIntMap))
 	prd.deaths = append(prd.deaths, make(PlayerIntMap))
 	prd.assists = append(prd.assists, make(PlayerIntMap))
@@ -83,6 +116,16 @@ func (prd *PerRoundData) NewRound(isLive bool) {
 	prd.enemiesFlashed = append(prd.enemiesFlashed, make(PlayerIntMap))
 	prd.teammatesFlashed = append(prd.teammatesFlashed, make(PlayerIntMap))
 	prd.utilDamage = append(prd.utilDamage, make(PlayerIntMap))
+	prd.weapons = append(prd.weapons, make(PlayerWeaponMap))
+	prd.headDamage = append(prd.headDamage, make(PlayerIntMap))
+	prd.chestDamage = append(prd.chestDamage, make(PlayerIntMap))
+	prd.stomachDamage = append(prd.stomachDamage, make(PlayerIntMap))
+	prd.armDamage = append(prd.armDamage, make(PlayerIntMap))
+	prd.legDamage = append(prd.legDamage, make(PlayerIntMap))
+	prd.shotsFired = append(prd.shotsFired, make(PlayerIntMap))
+	prd.shotsHit = append(prd.shotsHit, make(PlayerIntMap))
+	prd.firstShotsFired = append(prd.firstShotsFired, make(PlayerIntMap))
+	prd.firstShotsHit = append(prd.firstShotsHit, make(PlayerIntMap))
 	prd.openings = append(prd.openings, nil)
 
 	prd.flashesThrown = append(prd.flashesThrown, make(PlayerIntMap))
@@ -91,13 +134,69 @@ func (prd *PerRoundData) NewRound(isLive bool) {
 	prd.smokesThrown = append(prd.smokesThrown, make(PlayerIntMap))
 
 	prd.headToHead = append(prd.headToHead, make(map[uint64]map[uint64]Kill))
+	prd.utility = append(prd.utility, make([]*Grenade, 0))
+	prd.heatmaps = append(prd.heatmaps, make(HeatmapData))
+	prd.replays = append(prd.replays, RoundReplay{
+		Frames: make([]ReplayFrame, 0),
+		Events: make([]ReplayEvent, 0),
+	})
 
 	prd.rounds = append(prd.rounds, Round{})
 	prd.winners = append(prd.winners, nil)
+	prd.economy = append(prd.economy, RoundEconomy{})
+	prd.sideSwitches = append(prd.sideSwitches, false)
+	prd.roundsPlayed = append(prd.roundsPlayed, roundsPlayed)
 
 	prd.isLive = append(prd.isLive, isLive)
 }
 
+// Counts a bullet fired in the current round and remembers it as the
+// shooter's last shot so the damage it does can be matched up with it
+func (prd *PerRoundData) AddShot(lastShots map[uint64]*Shot, shooter uint64, weapon common.EquipmentType, timeMs int64) {
+	addWeaponStats(
+		prd.weapons[len(prd.weapons)-1],
+		shooter,
+		getWeaponFileName(weapon),
+		WeaponStats{ShotsFired: 1},
+	)
+
+	shot := &Shot{
+		Weapon: weapon,
+		TimeMs: timeMs,
+	}
+	shot.FirstBullet = isFirstBullet(lastShots[shooter], shot.Weapon, shot.TimeMs)
+	lastShots[shooter] = shot
+
+	prd.shotsFired[len(prd.shotsFired)-1][shooter] += 1
+	if shot.FirstBullet {
+		prd.firstShotsFired[len(prd.firstShotsFired)-1][shooter] += 1
+	}
+}
+
+// Counts the damage done by the attacker's last shot. The damage always
+// counts but the hit is only counted once per shot so that shotgun
+// pellets and wallbangs through multiple players don't inflate the accuracy
+func (prd *PerRoundData) AddShotDamage(lastShots map[uint64]*Shot, attacker uint64, weapon common.EquipmentType, damage int) {
+	hits := 0
+	shot := lastShots[attacker]
+	if shot != nil && !shot.Hit && shot.Weapon == weapon {
+		shot.Hit = true
+		hits = 1
+
+		prd.shotsHit[len(prd.shotsHit)-1][attacker] += 1
+		if shot.FirstBullet {
+			prd.firstShotsHit[len(prd.firstShotsHit)-1][attacker] += 1
+		}
+	}
+
+	addWeaponStats(
+		prd.weapons[len(prd.weapons)-1],
+		attacker,
+		getWeaponFileName(weapon),
+		WeaponStats{Damage: damage, Hits: hits},
+	)
+}
+
 func (prd *PerRoundData) CropToRealRounds(useLiveMode bool) {
 	if useLiveMode {
 		prd.kills = filterByLiveRoundsInt(prd.kills, prd.isLive)
@@ -112,6 +211,16 @@ func (prd *PerRoundData) CropToRealRounds(useLiveMode bool) {
 		prd.enemiesFlashed = filterByLiveRoundsInt(prd.enemiesFlashed, prd.isLive)
 		prd.teammatesFlashed = filterByLiveRoundsInt(prd.teammatesFlashed, prd.isLive)
 		prd.utilDamage = filterByLiveRoundsInt(prd.utilDamage, prd.isLive)
+		prd.weapons = filterByLiveRoundsWeapons(prd.weapons, prd.isLive)
+		prd.headDamage = filterByLiveRoundsInt(prd.headDamage, prd.isLive)
+		prd.chestDamage = filterByLiveRoundsInt(prd.chestDamage, prd.isLive)
+		prd.stomachDamage = filterByLiveRoundsInt(prd.stomachDamage, prd.isLive)
+		prd.armDamage = filterByLiveRoundsInt(prd.armDamage, prd.isLive)
+		prd.legDamage = filterByLiveRoundsInt(prd.legDamage, prd.isLive)
+		prd.shotsFired = filterByLiveRoundsInt(prd.shotsFired, prd.isLive)
+		prd.shotsHit = filterByLiveRoundsInt(prd.shotsHit, prd.isLive)
+		prd.firstShotsFired = filterByLiveRoundsInt(prd.firstShotsFired, prd.isLive)
+		prd.firstShotsHit = filterByLiveRoundsInt(prd.firstShotsHit, prd.isLive)
 		prd.openings = filterByLiveRoundsOpeningKill(prd.openings, prd.isLive)
 
 		prd.flashesThrown = filterByLiveRoundsInt(prd.flashesThrown, prd.isLive)
@@ -120,9 +229,19 @@ func (prd *PerRoundData) CropToRealRounds(useLiveMode bool) {
 		prd.smokesThrown = filterByLiveRoundsInt(prd.smokesThrown, prd.isLive)
 
 		prd.headToHead = filterByLiveRoundsH2H(prd.headToHead, prd.isLive)
+		prd.utility = filterByLiveRoundsUtility(prd.utility, prd.isLive)
+		prd.heatmaps = filterByLiveRoundsHeatmaps(prd.heatmaps, prd.isLive)
+		prd.replays = filterByLiveRoundsReplays(prd.replays, prd.isLive)
 
 		prd.rounds = filterByLiveRoundsRounds(prd.rounds, prd.isLive)
 		prd.winners = filterByLiveRoundsWinners(prd.winners, prd.isLive)
+		prd.economy = filterByLiveRoundsEconomy(prd.economy, prd.isLive)
+		prd.sideSwitches = filterByLiveRoundsBool(prd.sideSwitches, prd.isLive)
+		prd.roundsPlayed = filterByLiveRoundsNumber(prd.roundsPlayed, prd.isLive)
+
+		// Has to be last since everything else is filtered by it. Kept
+		// lined up with the other rounds so Truncate and Append work
+		prd.isLive = filterByLiveRoundsBool(prd.isLive, prd.isLive)
 	} else {
 
 		// Figure out where the game actually goes live
@@ -140,30 +259,172 @@ func (prd *PerRoundData) CropToRealRounds(useLiveMode bool) {
 			}
 		}
 
-		prd.kills = prd.kills[startRound+1:]
-
-		prd.deaths = prd.deaths[startRound+1:]
-		prd.assists = prd.assists[startRound+1:]
-		prd.deathsTraded = prd.deathsTraded[startRound+1:]
-		prd.tradeKills = prd.tradeKills[startRound+1:]
-		prd.headshots = prd.headshots[startRound+1:]
-		prd.damage = prd.damage[startRound+1:]
-		prd.flashAssists = prd.flashAssists[startRound+1:]
-		prd.enemiesFlashed = prd.enemiesFlashed[startRound+1:]
-		prd.teammatesFlashed = prd.teammatesFlashed[startRound+1:]
-		prd.utilDamage = prd.utilDamage[startRound+1:]
-		prd.openings = prd.openings[startRound+1:]
-
-		prd.flashesThrown = prd.flashesThrown[startRound+1:]
-		prd.HEsThrown = prd.HEsThrown[startRound+1:]
-		prd.molliesThrown = prd.molliesThrown[startRound+1:]
-		prd.smokesThrown = prd.smokesThrown[startRound+1:]
-
-		prd.headToHead = prd.headToHead[startRound+1:]
-
-		prd.rounds = prd.rounds[startRound+1:]
-		prd.winners = prd.winners[startRound+1:]
+		// The first round is normally warmup, unless this demo picks
+		// up part way through a match (the next part of a merged
+		// match) in which case it's a real round
+		crop := startRound + 1
+		if startRound == 0 && prd.StartRound() > 0 {
+			crop = 0
+		}
+
+		prd.kills = prd.kills[crop:]
+
+		prd.deaths = prd.deaths[crop:]
+		prd.assists = prd.assists[crop:]
+		prd.deathsTraded = prd.deathsTraded[crop:]
+		prd.tradeKills = prd.tradeKills[crop:]
+		prd.headshots = prd.headshots[crop:]
+		prd.damage = prd.damage[crop:]
+		prd.flashAssists = prd.flashAssists[crop:]
+		prd.enemiesFlashed = prd.enemiesFlashed[crop:]
+		prd.teammatesFlashed = prd.teammatesFlashed[crop:]
+		prd.utilDamage = prd.utilDamage[crop:]
+		prd.weapons = prd.weapons[crop:]
+		prd.headDamage = prd.headDamage[crop:]
+		prd.chestDamage = prd.chestDamage[crop:]
+		prd.stomachDamage = prd.stomachDamage[crop:]
+		prd.armDamage = prd.armDamage[crop:]
+		prd.legDamage = prd.legDamage[crop:]
+		prd.shotsFired = prd.shotsFired[crop:]
+		prd.shotsHit = prd.shotsHit[crop:]
+		prd.firstShotsFired = prd.firstShotsFired[crop:]
+		prd.firstShotsHit = prd.firstShotsHit[crop:]
+		prd.openings = prd.openings[crop:]
+
+		prd.flashesThrown = prd.flashesThrown[crop:]
+		prd.HEsThrown = prd.HEsThrown[crop:]
+		prd.molliesThrown = prd.molliesThrown[crop:]
+		prd.smokesThrown = prd.smokesThrown[crop:]
+
+		prd.headToHead = prd.headToHead[crop:]
+		prd.utility = prd.utility[crop:]
+		prd.heatmaps = prd.heatmaps[crop:]
+		prd.replays = prd.replays[crop:]
+
+		prd.rounds = prd.rounds[crop:]
+		prd.winners = prd.winners[crop:]
+		prd.economy = prd.economy[crop:]
+		prd.sideSwitches = prd.sideSwitches[crop:]
+		prd.roundsPlayed = prd.roundsPlayed[crop:]
+		prd.isLive = prd.isLive[crop:]
+	}
+}
+
+// Removes the round that was in progress when the demo ended. Used when
+// recovering a truncated demo, since the last round never finished
+func (prd *PerRoundData) DropLastRound() {
+	if len(prd.rounds) > 0 {
+		prd.Truncate(len(prd.rounds) - 1)
+	}
+}
+
+// Keeps only the first n rounds
+func (prd *PerRoundData) Truncate(n int) {
+	prd.kills = prd.kills[:n]
+
+	prd.deaths = prd.deaths[:n]
+	prd.assists = prd.assists[:n]
+	prd.deathsTraded = prd.deathsTraded[:n]
+	prd.tradeKills = prd.tradeKills[:n]
+	prd.headshots = prd.headshots[:n]
+	prd.damage = prd.damage[:n]
+	prd.flashAssists = prd.flashAssists[:n]
+	prd.enemiesFlashed = prd.enemiesFlashed[:n]
+	prd.teammatesFlashed = prd.teammatesFlashed[:n]
+	prd.utilDamage = prd.utilDamage[:n]
+	prd.weapons = prd.weapons[:n]
+	prd.headDamage = prd.headDamage[:n]
+	prd.chestDamage = prd.chestDamage[:n]
+	prd.stomachDamage = prd.stomachDamage[:n]
+	prd.armDamage = prd.armDamage[:n]
+	prd.legDamage = prd.legDamage[:n]
+	prd.shotsFired = prd.shotsFired[:n]
+	prd.shotsHit = prd.shotsHit[:n]
+	prd.firstShotsFired = prd.firstShotsFired[:n]
+	prd.firstShotsHit = prd.firstShotsHit[:n]
+	prd.openings = prd.openings[:n]
+
+	prd.flashesThrown = prd.flashesThrown[:n]
+	prd.HEsThrown = prd.HEsThrown[:n]
+	prd.molliesThrown = prd.molliesThrown[:n]
+	prd.smokesThrown = prd.smokesThrown[:n]
+
+	prd.headToHead = prd.headToHead[:n]
+	prd.utility = prd.utility[:n]
+	prd.heatmaps = prd.heatmaps[:n]
+	prd.replays = prd.replays[:n]
+
+	prd.rounds = prd.rounds[:n]
+	prd.winners = prd.winners[:n]
+	prd.economy = prd.economy[:n]
+	prd.sideSwitches = prd.sideSwitches[:n]
+	prd.roundsPlayed = prd.roundsPlayed[:n]
+	prd.isLive = prd.isLive[:n]
+}
+
+// Adds the rounds from the other data onto the end of this one
+func (prd *PerRoundData) Append(other *PerRoundData) {
+	prd.kills = append(prd.kills, other.kills...)
+
+	prd.deaths = append(prd.deaths, other.deaths...)
+	prd.assists = append(prd.assists, other.assists...)
+	prd.deathsTraded = append(prd.deathsTraded, other.deathsTraded...)
+	prd.tradeKills = append(prd.tradeKills, other.tradeKills...)
+	prd.headshots = append(prd.headshots, other.headshots...)
+	prd.damage = append(prd.damage, other.damage...)
+	prd.flashAssists = append(prd.flashAssists, other.flashAssists...)
+	prd.enemiesFlashed = append(prd.enemiesFlashed, other.enemiesFlashed...)
+	prd.teammatesFlashed = append(prd.teammatesFlashed, other.teammatesFlashed...)
+	prd.utilDamage = append(prd.utilDamage, other.utilDamage...)
+	prd.weapons = append(prd.weapons, other.weapons...)
+	prd.headDamage = append(prd.headDamage, other.headDamage...)
+	prd.chestDamage = append(prd.chestDamage, other.chestDamage...)
+	prd.stomachDamage = append(prd.stomachDamage, other.stomachDamage...)
+	prd.armDamage = append(prd.armDamage, other.armDamage...)
+	prd.legDamage = append(prd.legDamage, other.legDamage...)
+	prd.shotsFired = append(prd.shotsFired, other.shotsFired...)
+	prd.shotsHit = append(prd.shotsHit, other.shotsHit...)
+	prd.firstShotsFired = append(prd.firstShotsFired, other.firstShotsFired...)
+	prd.firstShotsHit = append(prd.firstShotsHit, other.firstShotsHit...)
+	prd.openings = append(prd.openings, other.openings...)
+
+	prd.flashesThrown = append(prd.flashesThrown, other.flashesThrown...)
+	prd.HEsThrown = append(prd.HEsThrown, other.HEsThrown...)
+	prd.molliesThrown = append(prd.molliesThrown, other.molliesThrown...)
+	prd.smokesThrown = append(prd.smokesThrown, other.smokesThrown...)
+
+	prd.headToHead = append(prd.headToHead, other.headToHead...)
+	prd.utility = append(prd.utility, other.utility...)
+	prd.heatmaps = append(prd.heatmaps, other.heatmaps...)
+	prd.replays = append(prd.replays, other.replays...)
+
+	prd.rounds = append(prd.rounds, other.rounds...)
+	prd.winners = append(prd.winners, other.winners...)
+	prd.economy = append(prd.economy, other.economy...)
+	prd.sideSwitches = append(prd.sideSwitches, other.sideSwitches...)
+	prd.roundsPlayed = append(prd.roundsPlayed, other.roundsPlayed...)
+	prd.isLive = append(prd.isLive, other.isLive...)
+}
+
+// Adds the rounds from the next part of a match. If the next part picks
+// up from an earlier round than this one ended on (e.g. a backup from a
+// few rounds back was restored) the replayed rounds are taken from it
+func (prd *PerRoundData) Continue(next *PerRoundData) {
+	keep := next.StartRound() - prd.StartRound()
+	if keep >= 0 && keep < len(prd.rounds) {
+		prd.Truncate(keep)
+	}
+	prd.Append(next)
+}
+
+// How many rounds had been played according to the scoreboard when
+// the first round started. Non-zero if the demo picks up part way
+// through a match
+func (prd *PerRoundData) StartRound() int {
+	if len(prd.roundsPlayed) == 0 {
+		return 0
 	}
+	return prd.roundsPlayed[0]
 }
 
 func (prd *PerRoundData) ComputeTotals() Totals {
@@ -183,7 +444,18 @@ func (prd *PerRoundData) ComputeTotals() Totals {
 		hEsThrown:        arrayMapTotal(&prd.HEsThrown),
 		molliesThrown:    arrayMapTotal(&prd.molliesThrown),
 		smokesThrown:     arrayMapTotal(&prd.smokesThrown),
+		weapons:          weaponMapTotal(&prd.weapons),
+		headDamage:       arrayMapTotal(&prd.headDamage),
+		chestDamage:      arrayMapTotal(&prd.chestDamage),
+		stomachDamage:    arrayMapTotal(&prd.stomachDamage),
+		armDamage:        arrayMapTotal(&prd.armDamage),
+		legDamage:        arrayMapTotal(&prd.legDamage),
+		shotsFired:       arrayMapTotal(&prd.shotsFired),
+		shotsHit:         arrayMapTotal(&prd.shotsHit),
+		firstShotsFired:  arrayMapTotal(&prd.firstShotsFired),
+		firstShotsHit:    arrayMapTotal(&prd.firstShotsHit),
 		openingKills:     derefOpeningKillArray(prd.openings),
+		heatmaps:         heatmapsTotal(&prd.heatmaps),
 	}
 }
 
@@ -0,0 +1,249 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+const testPlayer uint64 = 76561197960287930
+
+// Builds the per round data for rounds numbered first to first+n-1. Each
+// round's number is stored in a few of the slices so that it can be
+// checked which rounds are left afterwards
+func newTestRounds(first, n int, isLive func(round int) bool) PerRoundData {
+	var prd PerRoundData
+	for i := 0; i < n; i++ {
+		round := first + i
+		prd.NewRound(isLive(round), round)
+		prd.kills[i][testPlayer] = round
+		prd.damage[i][testPlayer] = round * 100
+		prd.rounds[i].Reason = round
+		prd.winners[i] = []uint64{testPlayer}
+	}
+	return prd
+}
+
+func allLive(round int) bool {
+	return true
+}
+
+// Returns the round numbers left in the data, checking that every one
+// of the per round slices is still the same length along the way
+func checkRounds(t *testing.T, prd *PerRoundData) []int {
+	t.Helper()
+
+	v := reflect.ValueOf(prd).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Slice && field.Len() != len(prd.rounds) {
+			t.Fatalf("%s has %d rounds but there are %d rounds", v.Type().Field(i).Name, field.Len(), len(prd.rounds))
+		}
+	}
+
+	rounds := make([]int, len(prd.rounds))
+	for i, round := range prd.rounds {
+		if prd.kills[i][testPlayer] != round.Reason || prd.damage[i][testPlayer] != round.Reason*100 {
+			t.Fatalf("round %d has data from other rounds mixed in", round.Reason)
+		}
+		rounds[i] = round.Reason
+	}
+	return rounds
+}
+
+func TestPerRoundDataCropLiveMode(t *testing.T) {
+	// Warmup and a couple of knife rounds before the match goes live
+	prd := newTestRounds(0, 10, func(round int) bool { return round >= 3 })
+	prd.CropToRealRounds(true)
+
+	got := checkRounds(t, &prd)
+	want := []int{3, 4, 5, 6, 7, 8, 9}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rounds %v, want %v", got, want)
+	}
+}
+
+func TestPerRoundDataCropRestarts(t *testing.T) {
+	// Rounds 2-4 are the triple restart with no kills in them
+	prd := newTestRounds(0, 10, allLive)
+	for _, round := range []int{2, 3, 4} {
+		prd.kills[round] = make(PlayerIntMap)
+		prd.damage[round] = make(PlayerIntMap)
+	}
+
+	prd.CropToRealRounds(false)
+
+	v := reflect.ValueOf(&prd).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Slice && field.Len() != 5 {
+			t.Fatalf("%s has %d rounds, want 5", v.Type().Field(i).Name, field.Len())
+		}
+	}
+
+	got := make([]int, len(prd.rounds))
+	for i, round := range prd.rounds {
+		got[i] = round.Reason
+	}
+
+	want := []int{5, 6, 7, 8, 9}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rounds %v, want %v", got, want)
+	}
+}
+
+func TestPerRoundDataTruncate(t *testing.T) {
+	prd := newTestRounds(0, 10, allLive)
+	prd.Truncate(4)
+
+	got := checkRounds(t, &prd)
+	want := []int{0, 1, 2, 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rounds %v, want %v", got, want)
+	}
+
+	prd.DropLastRound()
+	if got := checkRounds(t, &prd); len(got) != 3 {
+		t.Errorf("got %d rounds after dropping the last one, want 3", len(got))
+	}
+
+	empty := PerRoundData{}
+	empty.DropLastRound()
+	checkRounds(t, &empty)
+}
+
+func TestPerRoundDataContinue(t *testing.T) {
+	tests := []struct {
+		name     string
+		first    PerRoundData
+		next     PerRoundData
+		liveMode bool
+		want     []int
+	}{
+		{
+			name:     "carries on",
+			first:    newTestRounds(0, 8, allLive),
+			next:     newTestRounds(8, 4, allLive),
+			liveMode: true,
+			want:     []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+		{
+			// A backup from round 6 was restored after round 8 so the
+			// rounds that were played twice come from the second demo
+			name:     "restored from a backup",
+			first:    newTestRounds(0, 9, allLive),
+			next:     newTestRounds(6, 4, allLive),
+			liveMode: true,
+			want:     []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{
+			// Some rounds were never recorded
+			name:     "gap between demos",
+			first:    newTestRounds(0, 5, allLive),
+			next:     newTestRounds(7, 3, allLive),
+			liveMode: true,
+			want:     []int{0, 1, 2, 3, 4, 7, 8, 9},
+		},
+		{
+			name:     "first demo cropped",
+			first:    newTestRounds(0, 8, func(round int) bool { return round >= 2 }),
+			next:     newTestRounds(5, 3, allLive),
+			liveMode: true,
+			want:     []int{2, 3, 4, 5, 6, 7},
+		},
+		{
+			// The first demo's warmup round is dropped but the next
+			// demo starts on a real round which has to be kept
+			name:  "not in live mode",
+			first: newTestRounds(0, 8, allLive),
+			next:  newTestRounds(8, 4, allLive),
+			want:  []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first := test.first
+			next := test.next
+			first.CropToRealRounds(test.liveMode)
+			next.CropToRealRounds(test.liveMode)
+
+			first.Continue(&next)
+
+			got := checkRounds(t, &first)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got rounds %v, want %v", got, test.want)
+			}
+
+			if first.StartRound() != test.want[0] {
+				t.Errorf("got start round %d, want %d", first.StartRound(), test.want[0])
+			}
+		})
+	}
+}
+
+func TestPerRoundDataTotals(t *testing.T) {
+	prd := newTestRounds(1, 3, allLive)
+	totals := prd.ComputeTotals()
+
+	if totals.kills[testPlayer] != 6 || totals.damage[testPlayer] != 600 {
+		t.Errorf("got %d kills and %d damage, want 6 and 600", totals.kills[testPlayer], totals.damage[testPlayer])
+	}
+
+	if len(totals.openingKills) != 3 {
+		t.Errorf("got %d opening kills, want one per round", len(totals.openingKills))
+	}
+}
+
+func TestPerRoundDataShotgunHits(t *testing.T) {
+	var prd PerRoundData
+	prd.NewRound(true, 0)
+	lastShots := make(map[uint64]*Shot)
+
+	// One shot from a Nova with 5 pellets hitting two players
+	prd.AddShot(lastShots, testPlayer, common.EqNova, 1000)
+	for _, damage := range []int{26, 26, 13, 26, 13} {
+		prd.AddShotDamage(lastShots, testPlayer, common.EqNova, damage)
+	}
+
+	// And a second shot that only hits with one pellet
+	prd.AddShot(lastShots, testPlayer, common.EqNova, 2000)
+	prd.AddShotDamage(lastShots, testPlayer, common.EqNova, 9)
+
+	// And a third that misses
+	prd.AddShot(lastShots, testPlayer, common.EqNova, 3000)
+
+	weapons := computeWeaponAccuracy(prd.weapons[0])
+	nova := weapons[testPlayer][getWeaponFileName(common.EqNova)]
+	if nova.ShotsFired != 3 || nova.Hits != 2 || nova.Damage != 113 {
+		t.Errorf("got %d shots, %d hits and %d damage, want 3, 2 and 113", nova.ShotsFired, nova.Hits, nova.Damage)
+	}
+
+	if nova.Accuracy != 67 {
+		t.Errorf("got accuracy %v, want 67", nova.Accuracy)
+	}
+
+	if prd.shotsHit[0][testPlayer] != 2 || prd.firstShotsHit[0][testPlayer] != 2 {
+		t.Errorf("got %d shots hit and %d first shots hit, want 2 and 2", prd.shotsHit[0][testPlayer], prd.firstShotsHit[0][testPlayer])
+	}
+}
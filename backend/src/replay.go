@@ -0,0 +1,98 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/golang/geo/r3"
+)
+
+func getReplaySampleInterval(samplesPerSecond int) time.Duration {
+	if samplesPerSecond <= 0 {
+		return 0
+	}
+	return time.Second / time.Duration(samplesPerSecond)
+}
+
+// The replay and utility data can get pretty big so we will only
+// keep one decimal place on the radar coordinates
+func toRadarPosition(mapMetadata MapRadar, position r3.Vector) Position {
+	x, y := mapMetadata.TranslateScale(position.X, position.Y)
+	return Position{
+		X: math.Round(x*10) / 10,
+		Y: math.Round(y*10) / 10,
+	}
+}
+
+func sampleReplayFrame(gs DemoGameState, mapMetadata MapRadar, time int64) ReplayFrame {
+	frame := ReplayFrame{
+		Time:    time,
+		Players: make([]ReplayPlayer, 0, 10),
+	}
+
+	for _, player := range gs.Playing() {
+		weapon := ""
+		if player.ActiveWeapon != nil {
+			weapon = processWeaponName(*player.ActiveWeapon)
+		}
+
+		frame.Players = append(frame.Players, ReplayPlayer{
+			Id:       unBotify(player.SteamID64),
+			Side:     player.Side,
+			Position: toRadarPosition(mapMetadata, player.Position),
+			Yaw:      math.Round(float64(player.ViewDirectionX)),
+			Health:   player.Health,
+			Weapon:   weapon,
+		})
+	}
+
+	for _, grenade := range gs.GrenadeProjectiles() {
+		frame.Grenades = append(frame.Grenades, ReplayGrenade{
+			Type:     getGrenadeName(grenade.Type),
+			Position: toRadarPosition(mapMetadata, grenade.Position),
+		})
+	}
+
+	return frame
+}
+
+func newReplayEvent(
+	kind string,
+	time int64,
+	mapMetadata MapRadar,
+	position r3.Vector,
+	player *DemoPlayer,
+	entityId int,
+) ReplayEvent {
+	var playerId uint64 = 0
+	if player != nil {
+		playerId = unBotify(player.SteamID64)
+	}
+
+	return ReplayEvent{
+		Kind:     kind,
+		Time:     time,
+		Position: toRadarPosition(mapMetadata, position),
+		Player:   playerId,
+		EntityId: entityId,
+	}
+}
@@ -22,6 +22,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 
@@ -80,6 +81,111 @@ func route_match(c Context) func(*gin.Context) {
 	}
 }
 
+func route_heatmap(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id := ginc.Param("id")
+		dataSet := ginc.Param("dataset")
+		if strings.Contains(id, "..") || strings.Contains(id, "/") {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "bruh"})
+			return
+		}
+
+		if !isHeatmapDataset(dataSet) {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "heatmap dataset not found"})
+			return
+		}
+
+		var player uint64 = 0
+		if playerQ := ginc.Query("player"); playerQ != "" {
+			parsed, err := strconv.ParseUint(playerQ, 10, 64)
+			if err != nil {
+				ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid player id"})
+				return
+			}
+			player = parsed
+		}
+
+		side := ginc.Query("side")
+		if side != "" && side != "CT" && side != "T" {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "side must be CT or T"})
+			return
+		}
+
+		cacheDir := getHeatmapCacheDir(join(c.config.dataPath, "heatmaps"), id)
+		outPath := join(cacheDir, getHeatmapFileName(dataSet, player, side))
+
+		// heatmaps are only rendered once, after that we serve the cached image
+		if _, err := os.Stat(outPath); err != nil {
+			heatmap, err := c.db.GetHeatmap(id, dataSet)
+			if err != nil {
+				errString := fmt.Sprintf("Failed to fetch heatmap: %s", err.Error())
+				c.logger.Errorf(errString)
+				ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+				return
+			} else if heatmap == nil {
+				ginc.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
+				return
+			}
+
+			err = os.MkdirAll(cacheDir, os.ModePerm)
+			if err == nil {
+				err = genHeatmap(
+					filterHeatmapPoints(heatmap.Points, player, side),
+					heatmap.Map,
+					outPath,
+					join(c.config.assetsPath, "minimaps"),
+				)
+			}
+
+			if os.IsNotExist(err) {
+				ginc.JSON(http.StatusNotFound, gin.H{"error": "no overview image for map " + heatmap.Map})
+				return
+			} else if err != nil {
+				errString := fmt.Sprintf("demo=%s Failed to render heatmap: %s", id, err.Error())
+				c.logger.Errorf(errString)
+				ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+				return
+			}
+		}
+
+		ginc.File(outPath)
+	}
+}
+
+func route_roundReplay(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id := ginc.Param("id")
+
+		// rounds are one-indexed in the URL to match the round numbers
+		// shown in the frontend
+		round, err := strconv.Atoi(ginc.Param("n"))
+		if err != nil || round < 1 {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid round number"})
+			return
+		}
+
+		retrieved, err := c.db.GetRoundReplay(id, round-1)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch round replay: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+		} else if retrieved == nil {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
+		} else if retrieved.Replay == nil {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{
+				"message": gin.H{
+					"map":     retrieved.Map,
+					"minimap": "/assets/minimaps/" + retrieved.Map + ".jpg",
+					"frames":  retrieved.Replay.Frames,
+					"events":  retrieved.Replay.Events,
+				},
+			})
+		}
+	}
+}
+
 func route_history(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
 		limitQ := ginc.DefaultQuery("limit", "50")
@@ -142,6 +248,26 @@ func route_usermeta(c Context) func(*gin.Context) {
 	}
 }
 
+// Looks the demo up by its ID so that links ending in .dem keep working
+// when the demo is stored compressed. The file is served as-is, so
+// compressed demos are downloaded in their original format
+func route_demoDownload(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id := getDemoFileName(ginc.Param("file"))
+		path, err := c.demos.find(id)
+		if os.IsNotExist(err) {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "demo not found"})
+			return
+		} else if err != nil {
+			c.logger.Errorf("demo=%s failed to find demo file: %s", id, err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.store.Serve(ginc, path)
+	}
+}
+
 type RegisterPostData struct {
 	Username    string `json:"username"`
 	Password    string `json:"password"`
@@ -21,10 +21,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -53,6 +55,11 @@ func route_deleteMatch(c Context) func(*gin.Context) {
 			return
 		}
 
+		err = clearHeatmapCache(join(c.config.dataPath, "heatmaps"), id)
+		if err != nil {
+			c.logger.Warnf("demo=%s failed to clear heatmap cache: %s", id, err.Error())
+		}
+
 		c.db.InsertAuditEntry(AuditEntry{
 			Action:      "MATCH_DELETED",
 			Username:    getUsername(ginc),
@@ -66,22 +73,49 @@ func route_deleteMatch(c Context) func(*gin.Context) {
 func route_fullDeleteMatch(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
 		id := ginc.Param("id")
-		err := c.db.HardDeleteMatch(id)
+		parts, err := c.db.GetMatchParts(id)
 		if err != nil {
 			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		err = os.Remove(join(c.config.demosPath, id+".dem"))
+		// A merged match is made up of several demo files
+		demoIds := []string{id}
+		if len(parts) > 0 && parts[0].MatchId == id {
+			demoIds = make([]string, len(parts))
+			for i, part := range parts {
+				demoIds[i] = part.DemoId
+			}
+		}
+
+		err = c.db.HardDeleteMatch(id)
 		if err != nil {
 			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		err = clearHeatmapCache(join(c.config.dataPath, "heatmaps"), id)
+		if err != nil {
+			c.logger.Warnf("demo=%s failed to clear heatmap cache: %s", id, err.Error())
+		}
+
+		for _, demoId := range demoIds {
+			path, err := c.demos.find(demoId)
+			if err == nil {
+				err = c.store.Delete(path)
+				c.demos.remove(path)
+			}
+
+			if err != nil && !os.IsNotExist(err) {
+				ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		c.db.InsertAuditEntry(AuditEntry{
 			Action:      "MATCH_PERMANENTLY_DELETED",
 			Username:    getUsername(ginc),
-			Description: fmt.Sprintf("Match %s was deleted along with demo file", id),
+			Description: fmt.Sprintf("Match %s was deleted along with demo files %s", id, strings.Join(demoIds, ", ")),
 		})
 
 		ginc.JSON(http.StatusOK, gin.H{"message": "match permanently deleted"})
@@ -155,17 +189,293 @@ func route_editUser(c Context) func(*gin.Context) {
 
 func route_rescan(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
-		ginc.JSON(http.StatusOK, gin.H{
-			"message": "Incremental re-scan of demos folder started",
-		})
+		message := "Incremental re-scan of demos folder started"
+		if !requestRescan("api", c) {
+			message = "Rescan already in progress, the demos folder will be scanned again once it finishes"
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": message})
 
 		c.db.InsertAuditEntry(AuditEntry{
 			Action:      "RESCAN_TRIGGERED",
 			Username:    getUsername(ginc),
 			Description: "Rescan of demos folder was triggered by API call",
 		})
+	}
+}
+
+func route_rescanProgress(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		progress, err := c.db.GetLatestRescan()
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch rescan progress: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		if progress == nil {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "no rescans have been run yet"})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": progress})
+	}
+}
+
+func route_demoParseJobs(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id := ginc.Param("id")
+		jobs, err := c.db.GetDemoParseJobs(id)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch parse jobs: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		if len(jobs) == 0 {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "no parse jobs found for demo"})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": jobs})
+	}
+}
+
+func route_parseJobs(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		status := ginc.Query("status")
+		limitQ := ginc.DefaultQuery("limit", "50")
+		offsetQ := ginc.DefaultQuery("offset", "0")
+		limit, err := strconv.Atoi(limitQ)
+		if err != nil {
+			limit = 50
+		}
+
+		offset, err := strconv.Atoi(offsetQ)
+		if err != nil {
+			offset = 0
+		}
+
+		switch status {
+		case "", ParseJobQueued, ParseJobRunning, ParseJobDone, ParseJobFailed:
+		default:
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+			return
+		}
+
+		jobs, err := c.db.GetParseJobs(status, limit, offset)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch parse jobs: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{"message": jobs})
+		}
+	}
+}
+
+func route_brokenDemos(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		limitQ := ginc.DefaultQuery("limit", "50")
+		offsetQ := ginc.DefaultQuery("offset", "0")
+		limit, err := strconv.Atoi(limitQ)
+		if err != nil {
+			limit = 50
+		}
+
+		offset, err := strconv.Atoi(offsetQ)
+		if err != nil {
+			offset = 0
+		}
+
+		failures, err := c.db.GetParseFailures(limit, offset)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch broken demos: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{"message": failures})
+		}
+	}
+}
+
+func route_duplicateDemos(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		limitQ := ginc.DefaultQuery("limit", "50")
+		offsetQ := ginc.DefaultQuery("offset", "0")
+		limit, err := strconv.Atoi(limitQ)
+		if err != nil {
+			limit = 50
+		}
+
+		offset, err := strconv.Atoi(offsetQ)
+		if err != nil {
+			offset = 0
+		}
+
+		duplicates, err := c.db.GetDuplicateDemos(limit, offset)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch duplicate demos: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{"message": duplicates})
+		}
+	}
+}
+
+func route_retryParseJobs(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id := ginc.Param("id")
+		paths := make([]string, 0)
+
+		if id != "" {
+			path, err := c.demos.find(id)
+			if err != nil {
+				ginc.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("demo %s not found", id)})
+				return
+			}
+			paths = append(paths, path)
+		} else {
+			jobs, err := c.db.GetFailedParseJobs()
+			if err != nil {
+				errString := fmt.Sprintf("Failed to fetch failed parse jobs: %s", err.Error())
+				c.logger.Errorf(errString)
+				ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+				return
+			}
+
+			for _, job := range jobs {
+				paths = append(paths, job.Path)
+			}
+		}
+
+		if len(paths) == 0 {
+			ginc.JSON(http.StatusOK, gin.H{"message": "No failed demos to retry"})
+			return
+		}
+
+		started := c.coordinator.startRescan("retry", func() {
+			err := parseManyIdempotent(paths, join(c.config.dataPath, "heatmaps"), "retry", true, c)
+			if err != nil {
+				c.logger.Errorf("trigger=retry failed to retry demos: %s", err.Error())
+			}
+		})
+
+		if !started {
+			ginc.JSON(http.StatusConflict, gin.H{"error": "Rescan already in progress"})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("Retrying %d demo(s)", len(paths)),
+		})
+
+		c.db.InsertAuditEntry(AuditEntry{
+			Action:      "PARSE_RETRY_TRIGGERED",
+			Username:    getUsername(ginc),
+			Description: fmt.Sprintf("Retry of %d failed demo(s) was triggered by API call", len(paths)),
+		})
+	}
+}
+
+func route_matchParts(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id := ginc.Param("id")
+		parts, err := c.db.GetMatchParts(id)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch match parts: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{"message": parts})
+		}
+	}
+}
+
+type MergeDemosPostData struct {
+	// In the order that they were recorded. The match
+	// will be stored under the first demo's ID
+	Demos []string `json:"demos" binding:"required"`
+}
+
+func route_mergeDemos(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		var input MergeDemosPostData
+		if err := ginc.ShouldBindJSON(&input); err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(input.Demos) < 2 {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "at least two demos are needed to merge"})
+			return
+		}
+
+		seen := make(map[string]bool)
+		for _, id := range input.Demos {
+			if seen[id] || strings.ContainsAny(id, "/\\") {
+				ginc.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid demo %s", id)})
+				return
+			}
+			seen[id] = true
+
+			if _, err := c.demos.find(id); err != nil {
+				ginc.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("demo %s not found", id)})
+				return
+			}
+		}
+
+		err := mergeDemos(input.Demos, false, c)
+		if err == ErrParseInProgress {
+			ginc.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.logger.Errorf("failed to merge demos: %s", err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.db.InsertAuditEntry(AuditEntry{
+			Action:      "MATCH_MERGED",
+			Username:    getUsername(ginc),
+			Description: fmt.Sprintf("Demos %s were merged into one match", strings.Join(input.Demos, ", ")),
+		})
+
+		ginc.JSON(http.StatusOK, gin.H{"message": "demos merged"})
+	}
+}
+
+func route_splitMatch(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id := ginc.Param("id")
+		parts, err := c.db.GetMatchParts(id)
+		if err != nil {
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(parts) < 2 {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "match is not made up of multiple demos"})
+			return
+		}
+
+		err = splitMatch(parts, c)
+		if err != nil {
+			c.logger.Errorf("failed to split match: %s", err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.db.InsertAuditEntry(AuditEntry{
+			Action:      "MATCH_SPLIT",
+			Username:    getUsername(ginc),
+			Description: fmt.Sprintf("Match %s was split back into %d demos", parts[0].MatchId, len(parts)),
+		})
 
-		go doRescan("api", c)
+		ginc.JSON(http.StatusOK, gin.H{"message": "match split"})
 	}
 }
 
@@ -333,9 +643,17 @@ func route_logout(c Context) func(*gin.Context) {
 func route_restore(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
 		id := ginc.Param("id")
-		path := join(c.config.demosPath, id+".dem")
-		err := parseIdempotent(path, c.config.dataPath, true, c)
+		path, err := c.demos.find(id)
 		if err != nil {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("demo %s not found", id)})
+			return
+		}
+
+		err = parseIdempotent(path, join(c.config.dataPath, "heatmaps"), true, c)
+		if err == ErrParseInProgress {
+			ginc.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
 			c.logger.Errorf("failed to parse match during restore: %s", err.Error())
 			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -344,3 +662,311 @@ func route_restore(c Context) func(*gin.Context) {
 		}
 	}
 }
+
+type UploadPostData struct {
+	FileName string `json:"fileName" binding:"required"`
+	Size     int64  `json:"size" binding:"required"`
+}
+
+type UploadChunkResult struct {
+	// How much of the file has been received so far
+	Offset int64 `json:"offset"`
+	Done   bool  `json:"done"`
+	// Only set once the upload is done
+	DemoId string `json:"demoId,omitempty"`
+	// The parse job for the demo. Not set if the demo didn't need to be
+	// parsed (e.g. it's a copy of a demo that we already have)
+	JobId *int `json:"jobId,omitempty"`
+}
+
+// Uploads can only be seen and written to by the user who started them or an admin
+func getUserUpload(ginc *gin.Context, c Context) *Upload {
+	id := ginc.Param("id")
+	upload, err := c.db.GetUpload(id)
+	if err != nil {
+		ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+
+	userVal, _ := ginc.Get("user")
+	user, _ := userVal.(User)
+	isAdmin := false
+	for _, role := range user.Roles {
+		isAdmin = isAdmin || role == "admin"
+	}
+
+	if upload == nil || (upload.Username != user.Username && !isAdmin) {
+		ginc.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("upload %s not found", id)})
+		return nil
+	}
+
+	err = getUploadProgress(upload)
+	if err != nil {
+		ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+
+	return upload
+}
+
+func route_createUpload(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		var input UploadPostData
+		if err := ginc.ShouldBindJSON(&input); err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !isValidUploadName(input.FileName) {
+			ginc.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid file name, demos must end in one of %s", strings.Join(DemoExtensions, ", ")),
+			})
+			return
+		}
+
+		maxSize := int64(c.config.uploadMaxSize) * 1024 * 1024
+		if input.Size <= 0 || input.Size > maxSize {
+			ginc.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("size must be between 1 byte and %d MB", c.config.uploadMaxSize),
+			})
+			return
+		}
+
+		err := checkUploadName(input.FileName, c)
+		if err == ErrDemoExists {
+			ginc.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		upload, err := createUpload(input.FileName, input.Size, getUsername(ginc), c)
+		if err != nil {
+			c.logger.Errorf("failed to create upload: %s", err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": upload})
+	}
+}
+
+func route_uploadStatus(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		upload := getUserUpload(ginc, c)
+		if upload != nil {
+			ginc.JSON(http.StatusOK, gin.H{"message": upload})
+		}
+	}
+}
+
+// The request body is the raw chunk and the offset query parameter is where it
+// starts in the file. Sending the last chunk finishes the upload and queues the
+// demo to be parsed. If finishing fails part way (e.g. the demo was already being
+// parsed) it can be retried by sending an empty chunk at the end of the file
+func route_uploadChunk(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		offset, err := strconv.ParseInt(ginc.Query("offset"), 10, 64)
+		if err != nil || offset < 0 {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+
+		upload := getUserUpload(ginc, c)
+		if upload == nil {
+			return
+		}
+
+		if !c.uploads.claim(upload.Id) {
+			ginc.JSON(http.StatusConflict, gin.H{"error": ErrUploadInProgress.Error()})
+			return
+		}
+		defer c.uploads.release(upload.Id)
+
+		before := upload.Received
+		err = writeUploadChunk(upload, offset, ginc.Request.Body)
+		if err == ErrUploadOffsetMismatch {
+			ginc.JSON(http.StatusConflict, gin.H{"error": err.Error(), "offset": upload.Received})
+			return
+		} else if err == ErrUploadTooLarge {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "offset": upload.Received})
+			return
+		}
+
+		if touchErr := c.db.TouchUpload(upload.Id); touchErr != nil {
+			c.logger.Warnf("upload=%s failed to update upload: %s", upload.Id, touchErr.Error())
+		}
+
+		if err != nil {
+			c.logger.Warnf("upload=%s failed to write chunk: %s", upload.Id, err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "offset": upload.Received})
+			return
+		}
+
+		reject := func(reason error) {
+			if err := cancelUpload(upload, c); err != nil {
+				c.logger.Warnf("upload=%s failed to remove rejected upload: %s", upload.Id, err.Error())
+			}
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": reason.Error()})
+		}
+
+		if before < UploadCheckSize && (upload.Received >= UploadCheckSize || upload.Received == upload.Size) {
+			err = checkUploadStart(upload)
+			if err != nil {
+				reject(err)
+				return
+			}
+		}
+
+		if upload.Received < upload.Size {
+			ginc.JSON(http.StatusOK, gin.H{"message": UploadChunkResult{Offset: upload.Received}})
+			return
+		}
+
+		job, err := finishUpload(upload, c)
+		if err == ErrParseInProgress {
+			ginc.JSON(http.StatusConflict, gin.H{"error": err.Error(), "offset": upload.Received})
+			return
+		} else if err == ErrDemoExists {
+			if err := cancelUpload(upload, c); err != nil {
+				c.logger.Warnf("upload=%s failed to remove rejected upload: %s", upload.Id, err.Error())
+			}
+			ginc.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if errors.Is(err, ErrInvalidDemo) {
+			reject(err)
+			return
+		} else if err != nil {
+			c.logger.Errorf("upload=%s failed to finish upload: %s", upload.Id, err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "offset": upload.Received})
+			return
+		}
+
+		demoId := getDemoFileName(upload.FileName)
+		c.db.InsertAuditEntry(AuditEntry{
+			Action:      "DEMO_UPLOADED",
+			Username:    getUsername(ginc),
+			Description: fmt.Sprintf("Demo %s was uploaded", demoId),
+		})
+
+		result := UploadChunkResult{Offset: upload.Received, Done: true, DemoId: demoId}
+		if job != nil {
+			result.JobId = &job.id
+		}
+		ginc.JSON(http.StatusOK, gin.H{"message": result})
+	}
+}
+
+func route_cancelUpload(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		upload := getUserUpload(ginc, c)
+		if upload == nil {
+			return
+		}
+
+		if !c.uploads.claim(upload.Id) {
+			ginc.JSON(http.StatusConflict, gin.H{"error": ErrUploadInProgress.Error()})
+			return
+		}
+		defer c.uploads.release(upload.Id)
+
+		err := cancelUpload(upload, c)
+		if err != nil {
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": "upload cancelled"})
+	}
+}
+
+type ImportPostData struct {
+	Urls []string `json:"urls" binding:"required"`
+}
+
+// The demos are downloaded one at a time in the background. Their
+// progress can be followed with the import routes below
+func route_importDemos(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		var input ImportPostData
+		if err := ginc.ShouldBindJSON(&input); err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(input.Urls) == 0 {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "at least one URL is needed"})
+			return
+		}
+
+		for _, u := range input.Urls {
+			if !isValidImportUrl(u) {
+				ginc.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid URL %s", u)})
+				return
+			}
+		}
+
+		imports, err := queueDemoImports(input.Urls, getUsername(ginc), c)
+		if err != nil {
+			c.logger.Errorf("failed to queue imports: %s", err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		go func() {
+			for i := range imports {
+				err := runDemoImport(&imports[i], true, c)
+				if err != nil {
+					c.logger.Errorf("import=%d failed to import %s: %s", imports[i].Id, imports[i].Url, err.Error())
+				}
+			}
+		}()
+
+		ginc.JSON(http.StatusOK, gin.H{"message": imports})
+	}
+}
+
+func route_demoImports(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		limitQ := ginc.DefaultQuery("limit", "50")
+		offsetQ := ginc.DefaultQuery("offset", "0")
+		limit, err := strconv.Atoi(limitQ)
+		if err != nil {
+			limit = 50
+		}
+
+		offset, err := strconv.Atoi(offsetQ)
+		if err != nil {
+			offset = 0
+		}
+
+		imports, err := c.db.GetDemoImports(limit, offset)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch imports: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{"message": imports})
+		}
+	}
+}
+
+func route_demoImport(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id, err := strconv.Atoi(ginc.Param("id"))
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid import ID"})
+			return
+		}
+
+		demoImport, err := c.db.GetDemoImport(id)
+		if err != nil {
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		} else if demoImport == nil {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("import %d not found", id)})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{"message": demoImport})
+		}
+	}
+}
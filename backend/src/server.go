@@ -20,9 +20,9 @@
 package main
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -32,30 +32,70 @@ import (
 func doRescan(trigger string, c Context) {
 	c.logger.Infof("trigger=%s starting incremental demo folder rescan", trigger)
 
-	err := parseAllIdempotent(c.config.demosPath, c.config.dataPath, c)
+	err := parseAllIdempotent(c.config.dataPath, trigger, c)
 	if err != nil {
 		c.logger.Errorf("trigger=%s failed to re-scan demos folder: %s", trigger, err.Error())
 	} else {
 		c.logger.Infof("trigger=%s incremental demo folder rescan finished", trigger)
 	}
+
+	autoMergeDemos(c)
+}
+
+// Starts a rescan in the background. If one is already running the
+// rescan is run once it finishes instead. Returns whether the rescan
+// was started right away
+func requestRescan(trigger string, c Context) bool {
+	started := c.coordinator.startOrQueueRescan(trigger, func() {
+		doRescan(trigger, c)
+	})
+
+	if !started {
+		c.logger.Infof(
+			"trigger=%s rescan already in progress (trigger=%s), another one will run once it finishes",
+			trigger,
+			c.coordinator.runningRescan(),
+		)
+	}
+
+	return started
 }
 
 func watchFileChanges(c Context) {
 	heatmapsDir := join(c.config.dataPath, "heatmaps")
 	fileCreated := make(chan string, FileChangedChannelBuffer)
 	fileRenamed := make(chan FileRename, FileChangedChannelBuffer)
+	fileRemoved := make(chan string, FileChangedChannelBuffer)
 
-	// register our fsnotify watcher to send events to our
+	// register our fsnotify watcher (or the poller if inotify isn't
+	// available, e.g. when the demos are in S3) to send events to our
 	// fileChanged channel
-	go watchDemoDir(c.config.demosPath, fileCreated, fileRenamed, c.logger)
+	roots := make([]string, len(c.config.demoRoots))
+	for i, root := range c.config.demoRoots {
+		roots[i] = root.path
+	}
+
+	if c.config.watchMode == "poll" || !c.store.IsLocal() {
+		interval := time.Duration(c.config.watchPollInterval) * time.Second
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		go pollDemoDirs(c.store, roots, interval, fileCreated, fileRenamed, fileRemoved, c.logger)
+	} else {
+		go watchDemoDirs(roots, fileCreated, fileRenamed, fileRemoved, c.logger)
+	}
 
 	for {
 		select {
 		case created := <-fileCreated:
 			c.logger.Infof("new file detected: %s", created)
+			c.demos.add(created)
 			demoId := getDemoFileName(created)
+			unflagMissingDemos([]string{demoId}, c)
 			err := parseIdempotent(created, heatmapsDir, false, c)
-			if err != nil {
+			if err == ErrParseInProgress {
+				c.logger.Infof("demo=%s demo is already being parsed, skipping", demoId)
+			} else if err != nil {
 				c.logger.Errorf(
 					"demo=%s Failed to parse demo: %s",
 					demoId,
@@ -63,19 +103,16 @@ func watchFileChanges(c Context) {
 				)
 			} else {
 				c.logger.Infof("demo=%s added demo to database", demoId)
+				autoMergeDemos(c)
 			}
 		case renamed := <-fileRenamed:
 			c.logger.Infof("rename detected: %s -> %s", renamed.old, renamed.new)
+			c.demos.remove(renamed.old)
+			c.demos.add(renamed.new)
 			oldId := getDemoFileName(renamed.old)
 			newId := getDemoFileName(renamed.new)
 
-			c.db.InsertAuditEntry(AuditEntry{
-				System:      true,
-				Action:      "MATCH_RENAMED",
-				Description: fmt.Sprintf("Match %s was renamed to %s", oldId, newId),
-			})
-
-			err := c.db.RenameMatch(oldId, newId)
+			err := renameDemo(oldId, newId, c)
 			if err != nil {
 				c.logger.Errorf(
 					"demo=%s newName=%s failed to rename demo: %s",
@@ -83,8 +120,16 @@ func watchFileChanges(c Context) {
 					newId,
 					err.Error(),
 				)
-			} else {
-				c.logger.Infof("demo=%s newName=%s renamed demo", oldId, newId)
+			}
+		case removed := <-fileRemoved:
+			c.logger.Infof("removal detected: %s", removed)
+			err := removeDemo(removed, c)
+			if err != nil {
+				c.logger.Errorf(
+					"demo=%s failed to handle removed demo: %s",
+					getDemoFileName(removed),
+					err.Error(),
+				)
 			}
 		}
 	}
@@ -94,7 +139,7 @@ func registerJobs(s *gocron.Scheduler, c Context) {
 	c.logger.Info("registering scheduler jobs")
 
 	s.Every(c.config.rescanInterval).Minutes().Do(func() {
-		doRescan("cron", c)
+		requestRescan("cron", c)
 	})
 
 	s.Every(1).Hour().Do(func() {
@@ -109,6 +154,16 @@ func registerJobs(s *gocron.Scheduler, c Context) {
 			c.logger.Infof("trigger=cron finished clearing stale invalid tokens")
 		}
 	})
+
+	s.Every(1).Hour().Do(func() {
+		c.logger.Infof("trigger=cron clearing abandoned uploads")
+		err := cleanStaleUploads(c)
+		if err != nil {
+			c.logger.Errorf("trigger=cron failed to clean abandoned uploads: %s", err.Error())
+		} else {
+			c.logger.Infof("trigger=cron finished clearing abandoned uploads")
+		}
+	})
 }
 
 func genFileRoute(router *gin.Engine, maxAge int, basepath ...string) func(string) {
@@ -181,6 +236,26 @@ func runServer(c Context) {
 	assetRoute("/assets/maps/de_overpass.jpg")
 	assetRoute("/assets/maps/de_train.jpg")
 	assetRoute("/assets/maps/de_vertigo.jpg")
+	assetRoute("/assets/minimaps/de_ancient.jpg")
+	assetRoute("/assets/minimaps/de_cache.jpg")
+	assetRoute("/assets/minimaps/de_canals.jpg")
+	assetRoute("/assets/minimaps/de_cbble.jpg")
+	assetRoute("/assets/minimaps/de_dust.jpg")
+	assetRoute("/assets/minimaps/de_dust2.jpg")
+	assetRoute("/assets/minimaps/de_inferno.jpg")
+	assetRoute("/assets/minimaps/de_lake.jpg")
+	assetRoute("/assets/minimaps/de_mirage.jpg")
+	assetRoute("/assets/minimaps/de_nuke.jpg")
+	assetRoute("/assets/minimaps/de_nuke_lower.jpg")
+	assetRoute("/assets/minimaps/de_overpass.jpg")
+	assetRoute("/assets/minimaps/de_santorini.jpg")
+	assetRoute("/assets/minimaps/de_season.jpg")
+	assetRoute("/assets/minimaps/de_shortdust.jpg")
+	assetRoute("/assets/minimaps/de_shortnuke.jpg")
+	assetRoute("/assets/minimaps/de_shorttrain.jpg")
+	assetRoute("/assets/minimaps/de_train.jpg")
+	assetRoute("/assets/minimaps/de_vertigo.jpg")
+	assetRoute("/assets/minimaps/de_vertigo_lower.jpg")
 	assetRoute("/assets/weapons/eq_fraggrenade.png")
 	assetRoute("/assets/weapons/eq_taser.png")
 	assetRoute("/assets/weapons/fire.png")
@@ -238,6 +313,8 @@ func runServer(c Context) {
 
 		if c.config.matchVisibility == "public" {
 			v1.GET("/matches/:id", route_match(c))
+			v1.GET("/matches/:id/heatmaps/:dataset", route_heatmap(c))
+			v1.GET("/matches/:id/rounds/:n/replay", route_roundReplay(c))
 			v1.GET("/history", route_history(c))
 			v1.GET("/numMatches", route_numMatches(c))
 		}
@@ -251,7 +328,8 @@ func runServer(c Context) {
 		}
 
 		if c.config.allowDemoDownload {
-			v1.Static("/demos", c.config.demosPath)
+			v1.GET("/demos/:file", route_demoDownload(c))
+			v1.HEAD("/demos/:file", route_demoDownload(c))
 		}
 
 		v1Auth := v1.Group("/")
@@ -264,14 +342,27 @@ func runServer(c Context) {
 			v1Auth.POST("/logout", route_logout(c))
 
 			v1Auth.PATCH("/rescan", route_rescan(c))
+			v1Auth.GET("/rescan", route_rescanProgress(c))
+			v1Auth.GET("/parsejobs/demo/:id", route_demoParseJobs(c))
 
 			if c.config.matchVisibility == "private" {
 				v1Auth.GET("/matches/:id", route_match(c))
+				v1Auth.GET("/matches/:id/heatmaps/:dataset", route_heatmap(c))
+				v1Auth.GET("/matches/:id/rounds/:n/replay", route_roundReplay(c))
 				v1Auth.GET("/history", route_history(c))
 				v1Auth.GET("/numMatches", route_numMatches(c))
 			}
 		}
 
+		v1Upload := v1.Group("/")
+		v1Upload.Use(AllowedRoles(c, []string{"admin", "uploader"}))
+		{
+			v1Upload.POST("/uploads", route_createUpload(c))
+			v1Upload.GET("/uploads/:id", route_uploadStatus(c))
+			v1Upload.PATCH("/uploads/:id", route_uploadChunk(c))
+			v1Upload.DELETE("/uploads/:id", route_cancelUpload(c))
+		}
+
 		v1Admin := v1.Group("/")
 		v1Admin.Use(AllowedRoles(c, []string{"admin"}))
 		{
@@ -284,12 +375,24 @@ func runServer(c Context) {
 			v1Admin.GET("/deletedMatches", route_deletedMatches(c))
 			v1Admin.GET("/audit", route_auditLog(c))
 			v1Admin.GET("/auditsize", route_numAuditLogEntries(c))
+			v1Admin.GET("/parsejobs", route_parseJobs(c))
+			v1Admin.GET("/brokenDemos", route_brokenDemos(c))
+			v1Admin.GET("/duplicateDemos", route_duplicateDemos(c))
+			v1Admin.GET("/imports", route_demoImports(c))
+			v1Admin.GET("/imports/:id", route_demoImport(c))
+			v1Admin.POST("/imports", route_importDemos(c))
 
 			v1Admin.POST("/adminregister", route_register(c))
 			v1Admin.PUT("/usermeta/:id", route_editUserMeta(c))
 			v1Admin.PUT("/restore/:id", route_restore(c))
+			v1Admin.PUT("/parsejobs/retry", route_retryParseJobs(c))
+			v1Admin.PUT("/parsejobs/retry/:id", route_retryParseJobs(c))
 			v1Admin.DELETE("/matches/:id", route_deleteMatch(c))
 			v1Admin.DELETE("/fulldelete/matches/:id", route_fullDeleteMatch(c))
+
+			v1Admin.GET("/matchparts/:id", route_matchParts(c))
+			v1Admin.PUT("/matchparts", route_mergeDemos(c))
+			v1Admin.DELETE("/matchparts/:id", route_splitMatch(c))
 		}
 	}
 
@@ -31,12 +31,27 @@ type RetrievedMatch struct {
 	MatchData MatchData     `json:"matchData"`
 }
 
+type RetrievedHeatmap struct {
+	Map    string
+	Points []HeatmapPoint
+}
+
+type RetrievedReplay struct {
+	Map    string
+	Replay *RoundReplay
+}
+
 type Storage interface {
 	InsertUser(user User, password string) error
 	InsertAuditEntry(entry AuditEntry) error
 	UpsertMatches(match ...Match) error
+	// Replace the stored replays of a match. Kept apart from the rest
+	// of the match since they are only needed for the replay viewer
+	UpsertMatchReplays(id string, replays []RoundReplay) error
 	UpsertMatchMeta(id string, meta UserMeta) error
-	// Change the ID of a match (if the demo is renamed in the folder)
+	// Change the ID of a match (if the demo is renamed in the folder).
+	// Also renames the demo in its match's list of parts, and moves the
+	// match's replays over
 	RenameMatch(oldId, newId string) error
 	UpdateUser(username string, newInfo UserWithPassword) error
 
@@ -56,6 +71,11 @@ type Storage interface {
 	GetDeletedMatches(limit, offset int) ([]MetaData, error)
 	// Fetch user-defined data for the given match
 	GetUserMeta(id string) (*UserMeta, error)
+	// Fetch the points for one of the match's heatmap datasets
+	GetHeatmap(id, dataSet string) (*RetrievedHeatmap, error)
+	// Fetch the replay for a single round (zero-indexed). Replay will be
+	// nil if the match exists but the round doesn't
+	GetRoundReplay(id string, round int) (*RetrievedReplay, error)
 	GetUser(username string) (*User, error)
 	GetUsers() ([]User, error)
 	GetAuditLog(limit, offset int) ([]AuditEntry, error)
@@ -74,9 +94,112 @@ type Storage interface {
 	// Run database schema migrations in the up or down direction
 	RunMigration(config Config, dir string) error
 
+	// Start tracking a new rescan, returns the rescan's ID
+	InsertRescan(trigger string) (int, error)
+	// Set the number of demos that the rescan is going to parse
+	SetRescanTotal(id, total int) error
+	FinishRescan(id int) error
+	// Returns nil if there haven't been any rescans yet
+	GetLatestRescan() (*RescanProgress, error)
+	// Add a job in the queued state, returns the job's ID. rescanId
+	// should be 0 if the job isn't part of a rescan
+	InsertParseJob(demoId, path string, rescanId int) (int, error)
+	// Move the job to a new state. The error message is only stored
+	// for failed jobs
+	UpdateParseJob(id int, status, errorMessage string) error
+	// Fetch parse jobs, newest first. An empty status returns jobs
+	// in any state
+	GetParseJobs(status string, limit, offset int) ([]ParseJobEntry, error)
+	// Fetch all of the parse jobs for a single demo, newest first
+	GetDemoParseJobs(demoId string) ([]ParseJobEntry, error)
+	// Fetch the latest job for each demo whose most recent attempt failed
+	GetFailedParseJobs() ([]ParseJobEntry, error)
+	// Mark any jobs or rescans that were left unfinished (e.g. because
+	// the server was restarted mid-rescan) as failed
+	CleanInterruptedParseJobs() error
+
+	// Returns nil if the demo hasn't failed to parse since it was last
+	// parsed successfully
+	GetParseFailure(demoId string) (*ParseFailure, error)
+	// Insert or replace the failure record for the demo
+	UpsertParseFailure(failure ParseFailure) error
+	// Remove the failure record for the demo once it parses successfully
+	ClearParseFailure(demoId string) error
+	// Fetch the failure records, most recent failure first
+	GetParseFailures(limit, offset int) ([]ParseFailure, error)
+
+	// Fetch all of the parts of the match that the demo belongs to, in
+	// order. Empty if the demo hasn't been grouped with any others
+	GetMatchParts(demoId string) ([]MatchPart, error)
+	// Group the demos into a single match stored under the first demo's
+	// ID. Any groups that the demos were already in are broken up
+	SetMatchParts(demoIds []string, automatic bool) error
+	// Same as SetMatchParts, but also removes the standalone matches of all
+	// but the first demo and marks the first demo's match to be reparsed
+	MergeMatchParts(demoIds []string, automatic bool) error
+	// Mark the match as needing to be parsed again
+	InvalidateMatch(id string) error
+	// Fetch the matches which start part way through and haven't been
+	// grouped with (or explicitly split from) any other demos
+	GetUnmergedContinuations() ([]MatchSpan, error)
+	// Fetch the matches on the given map played between the two dates
+	GetMatchSpans(mapName string, from, to int64) ([]MatchSpan, error)
+
+	// Returns the ID of a match whose demo has the given content hash, or
+	// an empty string if there isn't one
+	GetMatchIdByHash(hash string) (string, error)
+	// Record the demo as a copy of an existing match's demo. Returns false
+	// if it was already recorded as a duplicate of the same match
+	InsertDuplicateDemo(duplicate DuplicateDemo) (bool, error)
+	// Returns nil if the demo isn't a known duplicate
+	GetDuplicateDemo(demoId string) (*DuplicateDemo, error)
+	// Fetch the known duplicate demos, most recently detected first
+	GetDuplicateDemos(limit, offset int) ([]DuplicateDemo, error)
+	ClearDuplicateDemo(demoId string) error
+
+	// Returns nil if the match doesn't exist
+	GetDemoFileInfo(id string) (*DemoFileInfo, error)
+	// Update the stored information about the match's demo file without
+	// parsing it again (e.g. if the file was touched but not changed)
+	SetDemoFileInfo(id string, info DemoFileInfo) error
+	// Flag or unflag the match as having its demo removed. Returns false
+	// if the match was already in that state
+	SetDemoMissing(id string, missing bool) (bool, error)
+	// Unflag the matches of any of the given demos that were flagged as
+	// having their demo removed, returns the IDs of the unflagged matches
+	ClearDemosMissing(ids []string) ([]string, error)
+	// Fetch the demos of the matches which haven't been deleted or flagged
+	// as missing their demo that aren't in the given list of demos
+	GetMissingDemoIds(ids []string) ([]string, error)
+
+	InsertUpload(upload Upload) error
+	// Returns nil if there is no such upload
+	GetUpload(id string) (*Upload, error)
+	// Bump the upload's updated time so that it isn't cleaned up
+	TouchUpload(id string) error
+	DeleteUpload(id string) error
+	// Fetch the uploads that haven't been added to since the given time
+	GetStaleUploads(before int64) ([]Upload, error)
+
+	// Add an import in the queued state, returns the import's ID. The
+	// username should be empty if the import wasn't started by a user
+	InsertDemoImport(url, username string) (int, error)
+	// Save the import's status, progress and result
+	UpdateDemoImport(demoImport DemoImport) error
+	// Returns nil if there is no such import
+	GetDemoImport(id int) (*DemoImport, error)
+	// Fetch the imports, newest first
+	GetDemoImports(limit, offset int) ([]DemoImport, error)
+	// Returns the URL that the demo was most recently imported from, or
+	// an empty string if it wasn't imported
+	GetDemoSourceUrl(demoId string) (string, error)
+	// Mark any imports that were cut off by the server stopping as failed
+	CleanInterruptedDemoImports() error
+
 	// Mark the given match as deleted (will not delete the demo itself)
 	SoftDeleteMatch(id string) error
-	// Fully remove the match from the database (will not delete the demo itself)
+	// Fully remove the match and its parts from the database (will not
+	// delete the demos themselves)
 	HardDeleteMatch(id string) error
 	// Delete user with the given username
 	DeleteUser(username string) error
@@ -30,6 +30,7 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/pgx"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -92,6 +93,31 @@ func (p *pgdb) transactionExec(query string, arguments ...interface{}) (int64, e
 	return commandTag.RowsAffected(), nil
 }
 
+// Replaces any groups that the demos are in with a single group
+// stored under the first demo's ID
+func setMatchParts(tx pgx.Tx, demoIds []string, automatic bool) error {
+	_, err := tx.Exec(
+		context.Background(),
+		`DELETE FROM match_parts
+		 WHERE match_id IN (SELECT match_id FROM match_parts WHERE demo_id = ANY($1))`,
+		demoIds,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		context.Background(),
+		`INSERT INTO match_parts (demo_id, match_id, part, automatic)
+		 SELECT demo_id, $2, ordinality - 1, $3
+		 FROM unnest($1::TEXT[]) WITH ORDINALITY AS t(demo_id, ordinality)`,
+		demoIds,
+		demoIds[0],
+		automatic,
+	)
+	return err
+}
+
 func (p *pgdb) getUser(username string, password *string) (*User, error) {
 	conn, err := p.dbpool.Acquire(context.Background())
 	if err != nil {
@@ -170,6 +196,11 @@ func (p *pgdb) genMatchInsert(match Match, base int, params *[]interface{}) (str
 		return "", err
 	}
 
+	heatmaps, err := json.Marshal(match.HeatMaps)
+	if err != nil {
+		return "", err
+	}
+
 	sql := valuesRowSql(base, MatchInsertNumFields)
 	*params = append(*params,
 		match.Meta.Id,
@@ -184,6 +215,16 @@ func (p *pgdb) genMatchInsert(match Match, base int, params *[]interface{}) (str
 		match.Meta.TeamATitle,
 		match.Meta.TeamBTitle,
 		string(match_data),
+		string(heatmaps),
+		match.Meta.Incomplete,
+		match.Meta.IncompleteReason,
+		match.Meta.DemoTypeSource,
+		match.Meta.DateSource,
+		match.Meta.ContentHash,
+		match.Meta.Tags,
+		match.DemoFile.Size,
+		match.DemoFile.ModTime,
+		match.Meta.SourceUrl,
 	)
 
 	return sql, nil
@@ -207,7 +248,15 @@ func (p *pgdb) getMatches(limit, offset int, deleted bool) ([]MetaData, error) {
 			   team_a_score,
 			   team_b_score,
 			   team_a_title,
-			   team_b_title
+			   team_b_title,
+			   incomplete,
+			   COALESCE(incomplete_reason, ''),
+			   COALESCE(demo_type_source, ''),
+			   COALESCE(date_source, ''),
+			   COALESCE(content_hash, ''),
+			   tags,
+			   demo_missing,
+			   COALESCE(source_url, '')
 			 FROM matches
 			 LEFT OUTER JOIN usermeta ON mapid = id
 			 WHERE deleted = $1
@@ -216,14 +265,19 @@ func (p *pgdb) getMatches(limit, offset int, deleted bool) ([]MetaData, error) {
 
 	matches := make([]MetaData, 0, 10)
 	for rows.Next() {
-		var id, mapName, demoType, teamATitle, teamBTitle string
+		var id, mapName, demoType, teamATitle, teamBTitle, incompleteReason string
+		var demoTypeSource, dateSource, contentHash, sourceUrl string
 		var dateTimestamp int64
 		var teamAScore, teamBScore int
 		var playerNames NamesMap
+		var incomplete, demoMissing bool
+		var tags []string
 
 		err = rows.Scan(
 			&id, &mapName, &dateTimestamp, &demoType, &playerNames,
 			&teamAScore, &teamBScore, &teamATitle, &teamBTitle,
+			&incomplete, &incompleteReason, &demoTypeSource, &dateSource, &contentHash,
+			&tags, &demoMissing, &sourceUrl,
 		)
 
 		if err != nil {
@@ -241,6 +295,15 @@ func (p *pgdb) getMatches(limit, offset int, deleted bool) ([]MetaData, error) {
 				TeamBScore:    teamBScore,
 				TeamATitle:    teamATitle,
 				TeamBTitle:    teamBTitle,
+
+				DemoTypeSource:   demoTypeSource,
+				DateSource:       dateSource,
+				ContentHash:      contentHash,
+				Tags:             tags,
+				DemoMissing:      demoMissing,
+				SourceUrl:        sourceUrl,
+				Incomplete:       incomplete,
+				IncompleteReason: incompleteReason,
 			})
 	}
 
@@ -305,7 +368,7 @@ func (p *pgdb) InsertAuditEntry(entry AuditEntry) error {
 	return err
 }
 
-const MatchInsertNumFields = 12
+const MatchInsertNumFields = 22
 
 func (p *pgdb) UpsertMatches(matches ...Match) error {
 	params := make([]interface{}, 0, len(matches)*MatchInsertNumFields)
@@ -332,7 +395,17 @@ func (p *pgdb) UpsertMatches(matches ...Match) error {
 				team_b_score,
 				team_a_title,
 				team_b_title,
-				match_data
+				match_data,
+				heatmaps,
+				incomplete,
+				incomplete_reason,
+				demo_type_source,
+				date_source,
+				content_hash,
+				tags,
+				demo_size,
+				demo_mtime,
+				source_url
 			  )
 			  VALUES ` + strings.Join(rows, ", ") + `
 			  ON CONFLICT (id) DO UPDATE
@@ -348,12 +421,64 @@ func (p *pgdb) UpsertMatches(matches ...Match) error {
 				team_b_score = EXCLUDED.team_b_score,
 				team_a_title = EXCLUDED.team_a_title,
 				team_b_title = EXCLUDED.team_b_title,
-				match_data = EXCLUDED.match_data`
+				match_data = EXCLUDED.match_data,
+				heatmaps = EXCLUDED.heatmaps,
+				incomplete = EXCLUDED.incomplete,
+				incomplete_reason = EXCLUDED.incomplete_reason,
+				demo_type_source = EXCLUDED.demo_type_source,
+				date_source = EXCLUDED.date_source,
+				content_hash = EXCLUDED.content_hash,
+				tags = EXCLUDED.tags,
+				demo_size = EXCLUDED.demo_size,
+				demo_mtime = EXCLUDED.demo_mtime,
+				source_url = EXCLUDED.source_url,
+				demo_missing = FALSE`
 
 	_, err := p.transactionExec(query, params...)
 	return err
 }
 
+// Each round is its own statement since a single round's
+// replay can already be quite large
+func (p *pgdb) UpsertMatchReplays(id string, replays []RoundReplay) error {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), `DELETE FROM match_replays WHERE match_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	for round, replay := range replays {
+		marshalled, err := json.Marshal(replay)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			context.Background(),
+			`INSERT INTO match_replays (match_id, round, replay) VALUES ($1, $2, $3)`,
+			id,
+			round,
+			string(marshalled),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(context.Background())
+}
+
 func (p *pgdb) UpsertMatchMeta(id string, meta UserMeta) error {
 	// If everything is null just delete the whole entry
 	if meta.DemoLink == "" && meta.DateOverride == 0 {
@@ -389,12 +514,54 @@ func (p *pgdb) UpsertMatchMeta(id string, meta UserMeta) error {
 }
 
 func (p *pgdb) RenameMatch(oldId, newId string) error {
-	_, err := p.transactionExec(
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(
+		context.Background(),
 		`UPDATE matches SET id = $1 WHERE id = $2`,
 		newId,
 		oldId,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		context.Background(),
+		`UPDATE match_replays SET match_id = $1 WHERE match_id = $2`,
+		newId,
+		oldId,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The demo might be one of the parts of a merged match
+	_, err = tx.Exec(
+		context.Background(),
+		`UPDATE match_parts
+		 SET
+		   demo_id = CASE WHEN demo_id = $2 THEN $1 ELSE demo_id END,
+		   match_id = CASE WHEN match_id = $2 THEN $1 ELSE match_id END
+		 WHERE demo_id = $2 OR match_id = $2`,
+		newId,
+		oldId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
 }
 
 func (p *pgdb) UpdateUser(username string, newInfo UserWithPassword) error {
@@ -569,11 +736,14 @@ func (p *pgdb) GetMatch(id string) (*RetrievedMatch, error) {
 	}
 	defer conn.Release()
 
-	var mapName, demoType, teamATitle, teamBTitle, demoLink string
+	var mapName, demoType, teamATitle, teamBTitle, demoLink, incompleteReason string
+	var demoTypeSource, dateSource, contentHash, sourceUrl string
 	var dateTimestamp int64
 	var teamAScore, teamBScore int
 	var playerNames NamesMap
 	var matchData MatchData
+	var incomplete, demoMissing bool
+	var tags []string
 
 	err = conn.
 		QueryRow(
@@ -587,8 +757,16 @@ func (p *pgdb) GetMatch(id string) (*RetrievedMatch, error) {
 			   team_b_score,
 			   team_a_title,
 			   team_b_title,
-			   COALESCE(usermeta.demo_link, FORMAT('/api/v1/demos/%s.dem', id)) AS demo_link,
-			   match_data
+			   COALESCE(usermeta.demo_link, NULLIF(source_url, ''), FORMAT('/api/v1/demos/%s.dem', id)) AS demo_link,
+			   match_data,
+			   incomplete,
+			   COALESCE(incomplete_reason, ''),
+			   COALESCE(demo_type_source, ''),
+			   COALESCE(date_source, ''),
+			   COALESCE(content_hash, ''),
+			   tags,
+			   demo_missing,
+			   COALESCE(source_url, '')
 		     FROM matches
 			 LEFT OUTER JOIN usermeta ON mapid = id
 			 WHERE id = $1 AND deleted = FALSE`, id).
@@ -603,6 +781,14 @@ func (p *pgdb) GetMatch(id string) (*RetrievedMatch, error) {
 			&teamBTitle,
 			&demoLink,
 			&matchData,
+			&incomplete,
+			&incompleteReason,
+			&demoTypeSource,
+			&dateSource,
+			&contentHash,
+			&tags,
+			&demoMissing,
+			&sourceUrl,
 		)
 
 	if err != nil {
@@ -624,6 +810,15 @@ func (p *pgdb) GetMatch(id string) (*RetrievedMatch, error) {
 				TeamBScore:    teamBScore,
 				TeamATitle:    teamATitle,
 				TeamBTitle:    teamBTitle,
+
+				DemoTypeSource:   demoTypeSource,
+				DateSource:       dateSource,
+				ContentHash:      contentHash,
+				Tags:             tags,
+				DemoMissing:      demoMissing,
+				SourceUrl:        sourceUrl,
+				Incomplete:       incomplete,
+				IncompleteReason: incompleteReason,
 			},
 			DemoLink: demoLink,
 		},
@@ -680,6 +875,77 @@ func (p *pgdb) GetUserMeta(id string) (*UserMeta, error) {
 	}, nil
 }
 
+func (p *pgdb) GetHeatmap(id, dataSet string) (*RetrievedHeatmap, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var mapName string
+	var points []HeatmapPoint
+
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT
+			   map,
+			   COALESCE(heatmaps -> $2::TEXT, '[]'::JSON)
+			 FROM matches
+			 WHERE id = $1 AND deleted = FALSE`,
+			id,
+			dataSet,
+		).
+		Scan(&mapName, &points)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &RetrievedHeatmap{
+		Map:    mapName,
+		Points: points,
+	}, nil
+}
+
+func (p *pgdb) GetRoundReplay(id string, round int) (*RetrievedReplay, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var mapName string
+	var replay *RoundReplay
+
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT map, replay
+			 FROM matches
+			 LEFT OUTER JOIN match_replays ON match_id = id AND round = $2
+			 WHERE id = $1 AND deleted = FALSE`,
+			id,
+			round,
+		).
+		Scan(&mapName, &replay)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &RetrievedReplay{
+		Map:    mapName,
+		Replay: replay,
+	}, nil
+}
+
 func (p *pgdb) GetUser(username string) (*User, error) {
 	return p.getUser(username, nil)
 }
@@ -839,28 +1105,1114 @@ func (p *pgdb) RunMigration(config Config, dir string) error {
 	return nil
 }
 
-func (p *pgdb) SoftDeleteMatch(id string) error {
+func (p *pgdb) InsertRescan(trigger string) (int, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	id := 0
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`INSERT INTO rescans (trigger, started_at) VALUES ($1, $2) RETURNING id`,
+			trigger,
+			time.Now().UnixMilli(),
+		).
+		Scan(&id)
+
+	return id, err
+}
+
+func (p *pgdb) SetRescanTotal(id, total int) error {
+	_, err := p.transactionExec(`UPDATE rescans SET total = $2 WHERE id = $1`, id, total)
+	return err
+}
+
+func (p *pgdb) FinishRescan(id int) error {
 	_, err := p.transactionExec(
-		`UPDATE matches
-		 SET
-		   version = 0,
-		   deleted = TRUE,
-		   match_data = '{}',
-		   player_names = '{}'
-	     WHERE id = $1`, id)
+		`UPDATE rescans SET finished_at = $2 WHERE id = $1`,
+		id,
+		time.Now().UnixMilli(),
+	)
 	return err
 }
 
-func (p *pgdb) HardDeleteMatch(id string) error {
-	_, err := p.transactionExec(`DELETE FROM matches WHERE id = $1`, id)
+func (p *pgdb) GetLatestRescan() (*RescanProgress, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var progress RescanProgress
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT
+			   rescans.id,
+			   rescans.trigger,
+			   rescans.started_at,
+			   rescans.finished_at,
+			   rescans.total,
+			   COUNT(*) FILTER (WHERE parse_jobs.status = 'queued'),
+			   COUNT(*) FILTER (WHERE parse_jobs.status = 'running'),
+			   COUNT(*) FILTER (WHERE parse_jobs.status = 'done'),
+			   COUNT(*) FILTER (WHERE parse_jobs.status = 'failed')
+			 FROM rescans
+			 LEFT OUTER JOIN parse_jobs ON parse_jobs.rescan_id = rescans.id
+			 GROUP BY rescans.id
+			 ORDER BY rescans.id DESC
+			 LIMIT 1`,
+		).
+		Scan(
+			&progress.Id,
+			&progress.Trigger,
+			&progress.StartedAt,
+			&progress.FinishedAt,
+			&progress.Total,
+			&progress.Queued,
+			&progress.Running,
+			&progress.Done,
+			&progress.Failed,
+		)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+func (p *pgdb) InsertParseJob(demoId, path string, rescanId int) (int, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	var rescan *int
+	if rescanId != 0 {
+		rescan = &rescanId
+	}
+
+	id := 0
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`INSERT INTO parse_jobs
+			   (demo_id, path, rescan_id, status, queued_at)
+			 VALUES ($1, $2, $3, $4, $5)
+			 RETURNING id`,
+			demoId,
+			path,
+			rescan,
+			ParseJobQueued,
+			time.Now().UnixMilli(),
+		).
+		Scan(&id)
+
+	return id, err
+}
+
+func (p *pgdb) UpdateParseJob(id int, status, errorMessage string) error {
+	var errorText *string
+	if status == ParseJobFailed {
+		errorText = &errorMessage
+	}
+
+	_, err := p.transactionExec(
+		`UPDATE parse_jobs
+		 SET
+		   status = $2,
+		   error = $3,
+		   started_at = CASE WHEN $2 = 'running' THEN $4 ELSE started_at END,
+		   finished_at = CASE WHEN $2 IN ('done', 'failed') THEN $4 ELSE finished_at END
+		 WHERE id = $1`,
+		id,
+		status,
+		errorText,
+		time.Now().UnixMilli(),
+	)
 	return err
 }
 
-func (p *pgdb) DeleteUser(username string) error {
-	_, err := p.transactionExec(`DELETE FROM users WHERE username = $1`, username)
+const parseJobColumns = `id, demo_id, path, rescan_id, status, COALESCE(error, ''), queued_at, started_at, finished_at`
+
+func (p *pgdb) queryParseJobs(query string, arguments ...interface{}) ([]ParseJobEntry, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(context.Background(), query, arguments...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]ParseJobEntry, 0)
+	for rows.Next() {
+		var job ParseJobEntry
+		err = rows.Scan(
+			&job.Id,
+			&job.DemoId,
+			&job.Path,
+			&job.RescanId,
+			&job.Status,
+			&job.Error,
+			&job.QueuedAt,
+			&job.StartedAt,
+			&job.FinishedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func (p *pgdb) GetParseJobs(status string, limit, offset int) ([]ParseJobEntry, error) {
+	return p.queryParseJobs(
+		`SELECT `+parseJobColumns+`
+		 FROM parse_jobs
+		 WHERE $1 = '' OR status = $1
+		 ORDER BY id DESC
+		 LIMIT $2 OFFSET $3`,
+		status,
+		limit,
+		offset,
+	)
+}
+
+func (p *pgdb) GetDemoParseJobs(demoId string) ([]ParseJobEntry, error) {
+	return p.queryParseJobs(
+		`SELECT `+parseJobColumns+`
+		 FROM parse_jobs
+		 WHERE demo_id = $1
+		 ORDER BY id DESC`,
+		demoId,
+	)
+}
+
+func (p *pgdb) GetFailedParseJobs() ([]ParseJobEntry, error) {
+	return p.queryParseJobs(
+		`SELECT * FROM (
+		   SELECT DISTINCT ON (demo_id) ` + parseJobColumns + `
+		   FROM parse_jobs
+		   ORDER BY demo_id, id DESC
+		 ) AS latest
+		 WHERE status = 'failed'
+		 ORDER BY id DESC`,
+	)
+}
+
+func (p *pgdb) CleanInterruptedParseJobs() error {
+	now := time.Now().UnixMilli()
+	_, err := p.transactionExec(
+		`UPDATE parse_jobs
+		 SET status = 'failed', error = 'interrupted by server restart', finished_at = $1
+		 WHERE status IN ('queued', 'running')`,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.transactionExec(`UPDATE rescans SET finished_at = $1 WHERE finished_at IS NULL`, now)
 	return err
 }
 
-func (p *pgdb) Close() {
-	p.dbpool.Close()
+const parseFailureColumns = `demo_id, path, error, attempts, first_failed_at, last_failed_at, next_retry_at`
+
+func (p *pgdb) GetParseFailure(demoId string) (*ParseFailure, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var failure ParseFailure
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT `+parseFailureColumns+` FROM parse_failures WHERE demo_id = $1`,
+			demoId,
+		).
+		Scan(
+			&failure.DemoId,
+			&failure.Path,
+			&failure.Error,
+			&failure.Attempts,
+			&failure.FirstFailedAt,
+			&failure.LastFailedAt,
+			&failure.NextRetryAt,
+		)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &failure, nil
+}
+
+func (p *pgdb) UpsertParseFailure(failure ParseFailure) error {
+	_, err := p.transactionExec(
+		`INSERT INTO parse_failures (`+parseFailureColumns+`)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (demo_id) DO UPDATE SET
+		   path = EXCLUDED.path,
+		   error = EXCLUDED.error,
+		   attempts = EXCLUDED.attempts,
+		   first_failed_at = EXCLUDED.first_failed_at,
+		   last_failed_at = EXCLUDED.last_failed_at,
+		   next_retry_at = EXCLUDED.next_retry_at`,
+		failure.DemoId,
+		failure.Path,
+		failure.Error,
+		failure.Attempts,
+		failure.FirstFailedAt,
+		failure.LastFailedAt,
+		failure.NextRetryAt,
+	)
+	return err
+}
+
+func (p *pgdb) ClearParseFailure(demoId string) error {
+	_, err := p.transactionExec(`DELETE FROM parse_failures WHERE demo_id = $1`, demoId)
+	return err
+}
+
+func (p *pgdb) GetParseFailures(limit, offset int) ([]ParseFailure, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		context.Background(),
+		`SELECT `+parseFailureColumns+`
+		 FROM parse_failures
+		 ORDER BY last_failed_at DESC
+		 LIMIT $1 OFFSET $2`,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := make([]ParseFailure, 0)
+	for rows.Next() {
+		var failure ParseFailure
+		err = rows.Scan(
+			&failure.DemoId,
+			&failure.Path,
+			&failure.Error,
+			&failure.Attempts,
+			&failure.FirstFailedAt,
+			&failure.LastFailedAt,
+			&failure.NextRetryAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		failures = append(failures, failure)
+	}
+
+	return failures, rows.Err()
+}
+
+func (p *pgdb) GetMatchParts(demoId string) ([]MatchPart, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		context.Background(),
+		`SELECT match_id, demo_id, part, automatic
+		 FROM match_parts
+		 WHERE match_id = (SELECT match_id FROM match_parts WHERE demo_id = $1)
+		 ORDER BY part`,
+		demoId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := make([]MatchPart, 0)
+	for rows.Next() {
+		var part MatchPart
+		err = rows.Scan(&part.MatchId, &part.DemoId, &part.Part, &part.Automatic)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, part)
+	}
+
+	return parts, rows.Err()
+}
+
+func (p *pgdb) SetMatchParts(demoIds []string, automatic bool) error {
+	if len(demoIds) == 0 {
+		return nil
+	}
+
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	err = setMatchParts(tx, demoIds, automatic)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func (p *pgdb) MergeMatchParts(demoIds []string, automatic bool) error {
+	if len(demoIds) == 0 {
+		return nil
+	}
+
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	err = setMatchParts(tx, demoIds, automatic)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		context.Background(),
+		`DELETE FROM matches WHERE id = ANY($1)`,
+		demoIds[1:],
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		context.Background(),
+		`DELETE FROM match_replays WHERE match_id = ANY($1)`,
+		demoIds[1:],
+	)
+	if err != nil {
+		return err
+	}
+
+	// Version 0 is reserved for deleted matches
+	_, err = tx.Exec(
+		context.Background(),
+		`UPDATE matches SET version = -1 WHERE id = $1 AND deleted = FALSE`,
+		demoIds[0],
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func (p *pgdb) InvalidateMatch(id string) error {
+	// Version 0 is reserved for deleted matches
+	_, err := p.transactionExec(`UPDATE matches SET version = -1 WHERE id = $1 AND deleted = FALSE`, id)
+	return err
+}
+
+const matchSpanColumns = `id, map, date, player_names,
+  COALESCE((match_data->>'startRound')::INTEGER, 0),
+  COALESCE((match_data->>'totalRounds')::INTEGER, 0)`
+
+func (p *pgdb) queryMatchSpans(query string, arguments ...interface{}) ([]MatchSpan, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(context.Background(), query, arguments...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spans := make([]MatchSpan, 0)
+	for rows.Next() {
+		var span MatchSpan
+		err = rows.Scan(
+			&span.Id,
+			&span.Map,
+			&span.Date,
+			&span.PlayerNames,
+			&span.StartRound,
+			&span.TotalRounds,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		spans = append(spans, span)
+	}
+
+	return spans, rows.Err()
+}
+
+func (p *pgdb) GetUnmergedContinuations() ([]MatchSpan, error) {
+	return p.queryMatchSpans(
+		`SELECT ` + matchSpanColumns + `
+		 FROM matches
+		 WHERE
+		   deleted = FALSE
+		   AND COALESCE((match_data->>'startRound')::INTEGER, 0) > 0
+		   AND id NOT IN (SELECT demo_id FROM match_parts)
+		 ORDER BY date`,
+	)
+}
+
+func (p *pgdb) GetMatchSpans(mapName string, from, to int64) ([]MatchSpan, error) {
+	return p.queryMatchSpans(
+		`SELECT `+matchSpanColumns+`
+		 FROM matches
+		 WHERE deleted = FALSE AND map = $1 AND date >= $2 AND date <= $3
+		 ORDER BY date DESC`,
+		mapName,
+		from,
+		to,
+	)
+}
+
+func (p *pgdb) SoftDeleteMatch(id string) error {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(
+		context.Background(),
+		`UPDATE matches
+		 SET
+		   version = 0,
+		   deleted = TRUE,
+		   match_data = '{}',
+		   heatmaps = '{}',
+		   player_names = '{}'
+	     WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(context.Background(), `DELETE FROM match_replays WHERE match_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func (p *pgdb) HardDeleteMatch(id string) error {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), `DELETE FROM matches WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(context.Background(), `DELETE FROM match_parts WHERE match_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(context.Background(), `DELETE FROM match_replays WHERE match_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func (p *pgdb) DeleteUser(username string) error {
+	_, err := p.transactionExec(`DELETE FROM users WHERE username = $1`, username)
+	return err
+}
+
+func (p *pgdb) Close() {
+	p.dbpool.Close()
+}
+
+func (p *pgdb) GetMatchIdByHash(hash string) (string, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Release()
+
+	var id string
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT id FROM matches WHERE content_hash = $1 ORDER BY id LIMIT 1`,
+			hash,
+		).
+		Scan(&id)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return id, nil
+}
+
+const duplicateDemoColumns = `demo_id, match_id, content_hash, detected_at`
+
+func (p *pgdb) InsertDuplicateDemo(duplicate DuplicateDemo) (bool, error) {
+	// Only counts as new if the demo wasn't already recorded as a
+	// duplicate of the same match
+	rowsAffected, err := p.transactionExec(
+		`INSERT INTO duplicate_demos (`+duplicateDemoColumns+`)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (demo_id) DO UPDATE SET
+		   match_id = EXCLUDED.match_id,
+		   content_hash = EXCLUDED.content_hash,
+		   detected_at = EXCLUDED.detected_at
+		 WHERE duplicate_demos.match_id <> EXCLUDED.match_id
+		   OR duplicate_demos.content_hash <> EXCLUDED.content_hash`,
+		duplicate.DemoId,
+		duplicate.MatchId,
+		duplicate.ContentHash,
+		duplicate.DetectedAt,
+	)
+	return rowsAffected > 0, err
+}
+
+func (p *pgdb) GetDuplicateDemo(demoId string) (*DuplicateDemo, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var duplicate DuplicateDemo
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT `+duplicateDemoColumns+` FROM duplicate_demos WHERE demo_id = $1`,
+			demoId,
+		).
+		Scan(
+			&duplicate.DemoId,
+			&duplicate.MatchId,
+			&duplicate.ContentHash,
+			&duplicate.DetectedAt,
+		)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &duplicate, nil
+}
+
+func (p *pgdb) GetDuplicateDemos(limit, offset int) ([]DuplicateDemo, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		context.Background(),
+		`SELECT `+duplicateDemoColumns+`
+		 FROM duplicate_demos
+		 ORDER BY detected_at DESC
+		 LIMIT $1 OFFSET $2`,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	duplicates := make([]DuplicateDemo, 0)
+	for rows.Next() {
+		var duplicate DuplicateDemo
+		err = rows.Scan(
+			&duplicate.DemoId,
+			&duplicate.MatchId,
+			&duplicate.ContentHash,
+			&duplicate.DetectedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		duplicates = append(duplicates, duplicate)
+	}
+
+	return duplicates, rows.Err()
+}
+
+func (p *pgdb) ClearDuplicateDemo(demoId string) error {
+	_, err := p.transactionExec(`DELETE FROM duplicate_demos WHERE demo_id = $1`, demoId)
+	return err
+}
+
+func (p *pgdb) GetDemoFileInfo(id string) (*DemoFileInfo, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var info DemoFileInfo
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT
+			   COALESCE(content_hash, ''),
+			   COALESCE(demo_size, 0),
+			   COALESCE(demo_mtime, 0)
+			 FROM matches
+			 WHERE id = $1`,
+			id,
+		).
+		Scan(&info.ContentHash, &info.Size, &info.ModTime)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (p *pgdb) SetDemoFileInfo(id string, info DemoFileInfo) error {
+	_, err := p.transactionExec(
+		`UPDATE matches SET content_hash = $2, demo_size = $3, demo_mtime = $4 WHERE id = $1`,
+		id,
+		info.ContentHash,
+		info.Size,
+		info.ModTime,
+	)
+	return err
+}
+
+func (p *pgdb) SetDemoMissing(id string, missing bool) (bool, error) {
+	rowsAffected, err := p.transactionExec(
+		`UPDATE matches SET demo_missing = $2 WHERE id = $1 AND demo_missing <> $2`,
+		id,
+		missing,
+	)
+	return rowsAffected > 0, err
+}
+
+func (p *pgdb) ClearDemosMissing(ids []string) ([]string, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		context.Background(),
+		`UPDATE matches SET demo_missing = FALSE
+		 WHERE demo_missing AND (
+		   id = ANY($1) OR
+		   id IN (SELECT match_id FROM match_parts WHERE demo_id = ANY($1))
+		 )
+		 RETURNING id`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cleared := make([]string, 0)
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		cleared = append(cleared, id)
+	}
+
+	return cleared, rows.Err()
+}
+
+func (p *pgdb) GetMissingDemoIds(ids []string) ([]string, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	// The later parts of a merged match only show up in match_parts
+	rows, err := conn.Query(
+		context.Background(),
+		`SELECT id FROM matches
+		 WHERE deleted = FALSE AND demo_missing = FALSE AND NOT id = ANY($1)
+		 UNION
+		 SELECT match_parts.demo_id FROM match_parts
+		 JOIN matches ON matches.id = match_parts.match_id
+		 WHERE
+		   matches.deleted = FALSE
+		   AND matches.demo_missing = FALSE
+		   AND NOT match_parts.demo_id = ANY($1)`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	missing := make([]string, 0)
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		missing = append(missing, id)
+	}
+
+	return missing, rows.Err()
+}
+
+const uploadColumns = `id, username, file_name, size, temp_path, created_at, updated_at`
+
+func (p *pgdb) InsertUpload(upload Upload) error {
+	_, err := p.transactionExec(
+		`INSERT INTO uploads (`+uploadColumns+`)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		upload.Id,
+		upload.Username,
+		upload.FileName,
+		upload.Size,
+		upload.TempPath,
+		upload.CreatedAt,
+		upload.UpdatedAt,
+	)
+	return err
+}
+
+func (p *pgdb) GetUpload(id string) (*Upload, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var upload Upload
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT `+uploadColumns+` FROM uploads WHERE id = $1`,
+			id,
+		).
+		Scan(
+			&upload.Id,
+			&upload.Username,
+			&upload.FileName,
+			&upload.Size,
+			&upload.TempPath,
+			&upload.CreatedAt,
+			&upload.UpdatedAt,
+		)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+func (p *pgdb) TouchUpload(id string) error {
+	_, err := p.transactionExec(
+		`UPDATE uploads SET updated_at = $2 WHERE id = $1`,
+		id,
+		time.Now().UnixMilli(),
+	)
+	return err
+}
+
+func (p *pgdb) DeleteUpload(id string) error {
+	_, err := p.transactionExec(`DELETE FROM uploads WHERE id = $1`, id)
+	return err
+}
+
+func (p *pgdb) GetStaleUploads(before int64) ([]Upload, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		context.Background(),
+		`SELECT `+uploadColumns+` FROM uploads WHERE updated_at < $1`,
+		before,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := make([]Upload, 0)
+	for rows.Next() {
+		var upload Upload
+		err = rows.Scan(
+			&upload.Id,
+			&upload.Username,
+			&upload.FileName,
+			&upload.Size,
+			&upload.TempPath,
+			&upload.CreatedAt,
+			&upload.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+func (p *pgdb) InsertDemoImport(url, username string) (int, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	var user *string
+	if username != "" {
+		user = &username
+	}
+
+	id := 0
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`INSERT INTO demo_imports
+			   (url, username, status, created_at)
+			 VALUES ($1, $2, $3, $4)
+			 RETURNING id`,
+			url,
+			user,
+			DemoImportQueued,
+			time.Now().UnixMilli(),
+		).
+		Scan(&id)
+
+	return id, err
+}
+
+func (p *pgdb) UpdateDemoImport(demoImport DemoImport) error {
+	var demoId, errorText *string
+	if demoImport.DemoId != "" {
+		demoId = &demoImport.DemoId
+	}
+	if demoImport.Status == DemoImportFailed {
+		errorText = &demoImport.Error
+	}
+
+	_, err := p.transactionExec(
+		`UPDATE demo_imports
+		 SET
+		   status = $2,
+		   demo_id = $3,
+		   received = $4,
+		   total = $5,
+		   error = $6,
+		   parse_job_id = $7,
+		   finished_at = CASE WHEN $2 IN ('done', 'failed') THEN $8 ELSE finished_at END
+		 WHERE id = $1`,
+		demoImport.Id,
+		demoImport.Status,
+		demoId,
+		demoImport.Received,
+		demoImport.Total,
+		errorText,
+		demoImport.ParseJobId,
+		time.Now().UnixMilli(),
+	)
+	return err
+}
+
+const demoImportColumns = `id, url, username, status, COALESCE(demo_id, ''), received, total, COALESCE(error, ''), parse_job_id, created_at, finished_at`
+
+func (p *pgdb) queryDemoImports(query string, arguments ...interface{}) ([]DemoImport, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(context.Background(), query, arguments...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imports := make([]DemoImport, 0)
+	for rows.Next() {
+		var demoImport DemoImport
+		err = rows.Scan(
+			&demoImport.Id,
+			&demoImport.Url,
+			&demoImport.Username,
+			&demoImport.Status,
+			&demoImport.DemoId,
+			&demoImport.Received,
+			&demoImport.Total,
+			&demoImport.Error,
+			&demoImport.ParseJobId,
+			&demoImport.CreatedAt,
+			&demoImport.FinishedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		imports = append(imports, demoImport)
+	}
+
+	return imports, rows.Err()
+}
+
+func (p *pgdb) GetDemoImport(id int) (*DemoImport, error) {
+	imports, err := p.queryDemoImports(
+		`SELECT `+demoImportColumns+` FROM demo_imports WHERE id = $1`,
+		id,
+	)
+	if err != nil || len(imports) == 0 {
+		return nil, err
+	}
+
+	return &imports[0], nil
+}
+
+func (p *pgdb) GetDemoImports(limit, offset int) ([]DemoImport, error) {
+	return p.queryDemoImports(
+		`SELECT `+demoImportColumns+`
+		 FROM demo_imports
+		 ORDER BY id DESC
+		 LIMIT $1 OFFSET $2`,
+		limit,
+		offset,
+	)
+}
+
+func (p *pgdb) GetDemoSourceUrl(demoId string) (string, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Release()
+
+	// The demo ID is only set once the download has started, so anything
+	// that hasn't failed is the source of the demo that's there now
+	url := ""
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT url FROM demo_imports
+			 WHERE demo_id = $1 AND status <> 'failed'
+			 ORDER BY id DESC
+			 LIMIT 1`,
+			demoId,
+		).
+		Scan(&url)
+
+	if err != nil && err.Error() == "no rows in result set" {
+		return "", nil
+	}
+
+	return url, err
+}
+
+func (p *pgdb) CleanInterruptedDemoImports() error {
+	_, err := p.transactionExec(
+		`UPDATE demo_imports
+		 SET status = 'failed', error = 'interrupted by server restart', finished_at = $1
+		 WHERE status IN ('queued', 'downloading')`,
+		time.Now().UnixMilli(),
+	)
+	return err
 }
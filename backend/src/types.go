@@ -19,7 +19,7 @@
 
 package main
 
-import "github.com/golang/geo/r2"
+import "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 
 type User struct {
 	Username    string   `json:"username"`
@@ -42,11 +42,125 @@ type AuditEntry struct {
 	Description string `json:"description"`
 }
 
+const (
+	ParseJobQueued  = "queued"
+	ParseJobRunning = "running"
+	ParseJobDone    = "done"
+	ParseJobFailed  = "failed"
+)
+
+const (
+	DemoImportQueued      = "queued"
+	DemoImportDownloading = "downloading"
+	DemoImportDone        = "done"
+	DemoImportFailed      = "failed"
+)
+
+type DemoImport struct {
+	Id  int    `json:"id"`
+	Url string `json:"url"`
+	// nil if the demo was imported from the command line
+	Username *string `json:"username"`
+	Status   string  `json:"status"`
+	DemoId   string  `json:"demoId"`
+	Received int64   `json:"received"`
+	// nil if the server didn't say how big the demo is
+	Total      *int64 `json:"total"`
+	Error      string `json:"error"`
+	ParseJobId *int   `json:"parseJobId"`
+	CreatedAt  int64  `json:"createdAt"`
+	FinishedAt *int64 `json:"finishedAt"`
+}
+
+type ParseJobEntry struct {
+	Id         int    `json:"id"`
+	DemoId     string `json:"demoId"`
+	Path       string `json:"-"`
+	RescanId   *int   `json:"rescanId"`
+	Status     string `json:"status"`
+	Error      string `json:"error"`
+	QueuedAt   int64  `json:"queuedAt"`
+	StartedAt  *int64 `json:"startedAt"`
+	FinishedAt *int64 `json:"finishedAt"`
+}
+
+type RescanProgress struct {
+	Id         int    `json:"id"`
+	Trigger    string `json:"trigger"`
+	StartedAt  int64  `json:"startedAt"`
+	FinishedAt *int64 `json:"finishedAt"`
+	Total      int    `json:"total"`
+	Queued     int    `json:"queued"`
+	Running    int    `json:"running"`
+	Done       int    `json:"done"`
+	Failed     int    `json:"failed"`
+}
+
+type ParseFailure struct {
+	DemoId        string `json:"demoId"`
+	Path          string `json:"-"`
+	Error         string `json:"error"`
+	Attempts      int    `json:"attempts"`
+	FirstFailedAt int64  `json:"firstFailedAt"`
+	LastFailedAt  int64  `json:"lastFailedAt"`
+	// Nil once the demo has run out of attempts
+	NextRetryAt *int64 `json:"nextRetryAt"`
+}
+
+type Upload struct {
+	Id        string `json:"id"`
+	Username  string `json:"username"`
+	FileName  string `json:"fileName"`
+	Size      int64  `json:"size"`
+	TempPath  string `json:"-"`
+	CreatedAt int64  `json:"createdAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+	// How much of the demo has been uploaded so far. This isn't stored,
+	// it's the size of the temp file
+	Received int64 `json:"received"`
+}
+
+// What the match's (first) demo file looked like when it was parsed
+type DemoFileInfo struct {
+	ContentHash string
+	Size        int64
+	// unix millis
+	ModTime int64
+}
+
+type DuplicateDemo struct {
+	DemoId      string `json:"demoId"`
+	MatchId     string `json:"matchId"`
+	ContentHash string `json:"contentHash"`
+	DetectedAt  int64  `json:"detectedAt"`
+}
+
+type MatchPart struct {
+	MatchId   string `json:"matchId"`
+	DemoId    string `json:"demoId"`
+	Part      int    `json:"part"`
+	Automatic bool   `json:"automatic"`
+}
+
+// Enough information about a stored match to tell
+// whether another demo carries on from it
+type MatchSpan struct {
+	Id          string
+	Map         string
+	Date        int64
+	PlayerNames NamesMap
+	StartRound  int
+	TotalRounds int
+}
+
 type StringIntMap map[string]int
 type StringF64Map map[string]float64
 type PlayerIntMap map[uint64]int
 type PlayerF64Map map[uint64]float64
 type KillFeed []map[uint64]map[uint64]Kill
+type ClutchMap map[int]PlayerIntMap
+type PlayerWeaponMap map[uint64]map[string]WeaponStats
+type HeatmapData map[string][]HeatmapPoint
 type TeamsMap map[uint64]string
 type NamesMap map[uint64]string
 
@@ -65,25 +179,58 @@ type MetaData struct {
 	TeamBScore    int      `json:"teamBScore"`
 	TeamATitle    string   `json:"teamATitle"`
 	TeamBTitle    string   `json:"teamBTitle"`
+
+	// Where the demo type and date were detected from (e.g. "header"
+	// or "filename"), useful for figuring out why a demo was misdetected
+	DemoTypeSource string `json:"demoTypeSource"`
+	DateSource     string `json:"dateSource"`
+	// sha256 of the match's (first) demo file
+	ContentHash string `json:"contentHash"`
+	// Tags from the demo folders that the match's demos are in
+	Tags []string `json:"tags"`
+	// Set when the demo file has been removed from the demos folder
+	DemoMissing bool `json:"demoMissing"`
+	// Where the demo was downloaded from if it was imported by URL
+	SourceUrl string `json:"sourceUrl"`
+
+	// Set when the demo ended early (e.g. the server crashed) and
+	// only the rounds that finished before then were kept
+	Incomplete       bool   `json:"incomplete"`
+	IncompleteReason string `json:"incompleteReason"`
 }
 
 type Match struct {
-	Meta      MetaData              `json:"meta"`
-	MatchData MatchData             `json:"matchData"`
-	HeatMaps  map[string][]r2.Point `json:"heatmaps"`
+	Meta      MetaData      `json:"meta"`
+	MatchData MatchData     `json:"matchData"`
+	HeatMaps  HeatmapData   `json:"heatmaps"`
+	Replays   []RoundReplay `json:"replays"`
+	// Only used for detecting changes to the demo, not sent to the frontend
+	DemoFile DemoFileInfo `json:"-"`
+}
+
+// Heatmap points are stored in the radar image's pixel coordinates
+type HeatmapPoint struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Player uint64  `json:"player,string"`
+	Side   string  `json:"side"`
 }
 
 type MatchData struct {
-	TotalRounds  int                     `json:"totalRounds"`
-	Teams        TeamsMap                `json:"teams"`
-	StartTeams   TeamsMap                `json:"startTeams"`
-	Rounds       []Round                 `json:"rounds"`
-	HalfLength   int                     `json:"halfLength"`
-	OpeningKills []OpeningKill           `json:"openingKills"`
-	HeadToHead   map[uint64]PlayerIntMap `json:"headToHead"`
-	KillFeed     KillFeed                `json:"killFeed"`
-	RoundByRound []RoundOverview         `json:"roundByRound"`
-	Stats        Stats                   `json:"stats"`
+	TotalRounds        int                     `json:"totalRounds"`
+	Teams              TeamsMap                `json:"teams"`
+	StartTeams         TeamsMap                `json:"startTeams"`
+	Rounds             []Round                 `json:"rounds"`
+	HalfLength         int                     `json:"halfLength"`
+	OvertimeHalfLength int                     `json:"overtimeHalfLength"`
+	StartRound         int                     `json:"startRound"`
+	OpeningKills       []OpeningKill           `json:"openingKills"`
+	HeadToHead         map[uint64]PlayerIntMap `json:"headToHead"`
+	KillFeed           KillFeed                `json:"killFeed"`
+	RoundByRound       []RoundOverview         `json:"roundByRound"`
+	Economy            []RoundEconomy          `json:"economy"`
+	Utility            [][]Grenade             `json:"utility"`
+	Stats              Stats                   `json:"stats"`
 }
 
 type Stats struct {
@@ -116,6 +263,23 @@ type Stats struct {
 	TradeKills         PlayerIntMap `json:"tradeKills"`
 	UtilDamage         PlayerIntMap `json:"utilDamage"`
 
+	HeadDamage          PlayerIntMap `json:"headDamage"`
+	ChestDamage         PlayerIntMap `json:"chestDamage"`
+	StomachDamage       PlayerIntMap `json:"stomachDamage"`
+	ArmDamage           PlayerIntMap `json:"armDamage"`
+	LegDamage           PlayerIntMap `json:"legDamage"`
+	ShotsFired          PlayerIntMap `json:"shotsFired"`
+	ShotsHit            PlayerIntMap `json:"shotsHit"`
+	Accuracy            PlayerF64Map `json:"accuracy"`
+	FirstBulletAccuracy PlayerF64Map `json:"firstBulletAccuracy"`
+
+	// Keyed by player and then weapon name
+	Weapons PlayerWeaponMap `json:"weapons"`
+
+	// Keyed by the number of opponents (1v1, 1v2 etc)
+	ClutchAttempts ClutchMap `json:"clutchAttempts"`
+	ClutchWins     ClutchMap `json:"clutchWins"`
+
 	// Can't name these 2k, 3k etc because identifiers can't start with
 	// numbers in Go
 	// "lul" - Tom
@@ -125,14 +289,44 @@ type Stats struct {
 	K5 PlayerIntMap `json:"5k"`
 }
 
+type WeaponStats struct {
+	Kills      int     `json:"kills"`
+	Headshots  int     `json:"headshots"`
+	Damage     int     `json:"damage"`
+	ShotsFired int     `json:"shotsFired"`
+	Hits       int     `json:"hits"`
+	Accuracy   float64 `json:"accuracy"`
+}
+
 type Round struct {
-	Winner          string `json:"winner"`
-	Reason          int    `json:"winReason"`
-	Planter         uint64 `json:"planter,string"`
-	Defuser         uint64 `json:"defuser,string"`
-	PlanterTime     int64  `json:"planterTime"`
-	DefuserTime     int64  `json:"defuserTime"`
-	BombExplodeTime int64  `json:"bombExplodeTime"`
+	Winner          string  `json:"winner"`
+	Reason          int     `json:"winReason"`
+	Planter         uint64  `json:"planter,string"`
+	Defuser         uint64  `json:"defuser,string"`
+	PlanterTime     int64   `json:"planterTime"`
+	DefuserTime     int64   `json:"defuserTime"`
+	BombExplodeTime int64   `json:"bombExplodeTime"`
+	Clutch          *Clutch `json:"clutch"`
+}
+
+type Clutch struct {
+	Player    uint64 `json:"player,string"`
+	Side      string `json:"side"`
+	Opponents int    `json:"opponents"`
+	Won       bool   `json:"won"`
+}
+
+type TeamEconomy struct {
+	EquipmentValue int    `json:"equipmentValue"`
+	MoneySpent     int    `json:"moneySpent"`
+	StartMoney     int    `json:"startMoney"`
+	BuyType        string `json:"buyType"`
+}
+
+// Economy for both sides, snapshotted at the end of freeze time
+type RoundEconomy struct {
+	CT TeamEconomy `json:"CT"`
+	T  TeamEconomy `json:"T"`
 }
 
 type Kill struct {
@@ -147,6 +341,46 @@ type Kill struct {
 	PenetratedObjects int    `json:"penetratedObjects"`
 	AttackerLocation  string `json:"attackerLocation"`
 	VictimLocation    string `json:"victimLocation"`
+
+	// Radar image pixel coordinates, same as the heatmap points
+	AttackerPosition Position `json:"attackerPosition"`
+	VictimPosition   Position `json:"victimPosition"`
+}
+
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type FlashedPlayer struct {
+	Player     uint64 `json:"player,string"`
+	DurationMs int64  `json:"durationMs"`
+	Teammate   bool   `json:"teammate"`
+}
+
+// A single thrown grenade. Times are relative to the start of the round
+// and positions are in radar image pixel coordinates
+type Grenade struct {
+	Type             string          `json:"type"`
+	Thrower          uint64          `json:"thrower,string"`
+	Side             string          `json:"side"`
+	ThrowTime        int64           `json:"throwTime"`
+	ThrowPosition    Position        `json:"throwPosition"`
+	DetonateTime     int64           `json:"detonateTime"`
+	DetonatePosition Position        `json:"detonatePosition"`
+	Flashed          []FlashedPlayer `json:"flashed"`
+	Damage           int             `json:"damage"`
+	SmokeDurationMs  int64           `json:"smokeDurationMs"`
+
+	equipment common.EquipmentType
+	detonated bool
+}
+
+type Shot struct {
+	Weapon      common.EquipmentType
+	TimeMs      int64
+	FirstBullet bool
+	Hit         bool
 }
 
 type Death struct {
@@ -171,9 +405,55 @@ type RoundEvent struct {
 }
 
 type RoundOverview struct {
-	TeamAScore int          `json:"teamAScore"`
-	TeamBScore int          `json:"teamBScore"`
-	TeamASide  string       `json:"teamASide"`
-	TeamBSide  string       `json:"teamBSide"`
-	Events     []RoundEvent `json:"events"`
+	TeamAScore int            `json:"teamAScore"`
+	TeamBScore int            `json:"teamBScore"`
+	TeamASide  string         `json:"teamASide"`
+	TeamBSide  string         `json:"teamBSide"`
+	Overtime   *RoundOvertime `json:"overtime"`
+	Events     []RoundEvent   `json:"events"`
+}
+
+type RoundOvertime struct {
+	// Both of these start at 1
+	Number     int `json:"number"`
+	Round      int `json:"round"`
+	TeamAScore int `json:"teamAScore"`
+	TeamBScore int `json:"teamBScore"`
+}
+
+// The replay JSON keys are kept short on purpose since there
+// are a lot of frames per round
+type ReplayPlayer struct {
+	Id       uint64   `json:"id,string"`
+	Side     string   `json:"side"`
+	Position Position `json:"pos"`
+	Yaw      float64  `json:"yaw"`
+	Health   int      `json:"hp"`
+	Weapon   string   `json:"w"`
+}
+
+type ReplayGrenade struct {
+	Type     string   `json:"type"`
+	Position Position `json:"pos"`
+}
+
+type ReplayFrame struct {
+	Time     int64           `json:"t"`
+	Players  []ReplayPlayer  `json:"p"`
+	Grenades []ReplayGrenade `json:"g,omitempty"`
+}
+
+type ReplayEvent struct {
+	Kind     string   `json:"kind"`
+	Time     int64    `json:"t"`
+	Position Position `json:"pos"`
+	Player   uint64   `json:"player,omitempty,string"`
+
+	// Used to pair up the start and end events for smokes, fires etc
+	EntityId int `json:"entityId,omitempty"`
+}
+
+type RoundReplay struct {
+	Frames []ReplayFrame `json:"frames"`
+	Events []ReplayEvent `json:"events"`
 }
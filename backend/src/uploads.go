@@ -0,0 +1,354 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long an upload can go without receiving a chunk before it's removed
+const StaleUploadAge = 24 * time.Hour
+
+// The start of the demo is checked as soon as this much has been uploaded
+const UploadCheckSize = 64 * 1024
+
+var (
+	ErrUploadInProgress     = errors.New("another chunk is already being written to this upload")
+	ErrUploadOffsetMismatch = errors.New("chunk offset does not match the amount uploaded so far")
+	ErrUploadTooLarge       = errors.New("chunk goes past the end of the upload")
+	ErrDemoExists           = errors.New("a demo with this name already exists")
+	ErrInvalidDemo          = errors.New("invalid demo")
+)
+
+// Stops chunks for the same upload from being written at the same time
+type UploadTracker struct {
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+func newUploadTracker() *UploadTracker {
+	return &UploadTracker{active: make(map[string]bool)}
+}
+
+// Returns false if the upload is already being written to
+func (t *UploadTracker) claim(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.active[id] {
+		return false
+	}
+
+	t.active[id] = true
+	return true
+}
+
+func (t *UploadTracker) release(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.active, id)
+}
+
+func newUploadId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Upload names have to be a plain file name in one of the supported formats
+func isValidUploadName(fileName string) bool {
+	return !strings.ContainsAny(fileName, "/\\") &&
+		!strings.HasPrefix(fileName, ".") &&
+		isDemoFile(fileName) &&
+		getDemoFileName(fileName) != ""
+}
+
+// Checks that there isn't already a demo (or another upload) that the
+// uploaded demo would clash with once it's moved into place
+func checkUploadName(fileName string, c Context) error {
+	if _, err := c.demos.find(getDemoFileName(fileName)); err == nil {
+		return ErrDemoExists
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if _, err := c.store.Stat(join(c.config.uploadPath, fileName)); err == nil {
+		return ErrDemoExists
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// The temp file is hidden and doesn't have a demo extension so that the
+// watcher and rescans ignore it. For local demo folders it's in the upload
+// folder itself so that it can be atomically renamed into place once the
+// upload is done
+func createUpload(fileName string, size int64, username string, c Context) (*Upload, error) {
+	id, err := newUploadId()
+	if err != nil {
+		return nil, err
+	}
+
+	tempDir := c.store.TempDir(c.config.uploadPath)
+	err = os.MkdirAll(tempDir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	tempPath := join(tempDir, "."+id+".upload")
+	f, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	now := time.Now().UnixMilli()
+	upload := Upload{
+		Id:        id,
+		Username:  username,
+		FileName:  fileName,
+		Size:      size,
+		TempPath:  tempPath,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = c.db.InsertUpload(upload)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+// Fills in how much of the upload has been received so far
+func getUploadProgress(upload *Upload) error {
+	info, err := os.Stat(upload.TempPath)
+	if err != nil {
+		return err
+	}
+
+	upload.Received = info.Size()
+	return nil
+}
+
+// Appends the chunk to the upload. The offset has to match the amount that
+// has already been received so that a retried chunk isn't written twice.
+// If the connection drops part way through a chunk whatever made it is
+// kept, and the client can pick up from there after checking the progress
+func writeUploadChunk(upload *Upload, offset int64, chunk io.Reader) error {
+	err := getUploadProgress(upload)
+	if err != nil {
+		return err
+	}
+
+	if offset != upload.Received {
+		return ErrUploadOffsetMismatch
+	}
+
+	f, err := os.OpenFile(upload.TempPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Read one byte past the end so we can tell if the chunk is too big
+	n, copyErr := io.Copy(f, io.LimitReader(chunk, upload.Size-offset+1))
+	if offset+n > upload.Size {
+		if err := f.Truncate(offset); err != nil {
+			return err
+		}
+		return ErrUploadTooLarge
+	}
+
+	upload.Received = offset + n
+	return copyErr
+}
+
+// Rejects uploads that clearly aren't demos as soon as the start of the
+// file arrives rather than after the whole thing has been uploaded. Zip
+// archives can only be checked once they're complete since their list
+// of files is at the end, and bzip2 only produces output once it has a
+// whole block (which can be bigger than what we've received so far)
+func checkUploadStart(upload *Upload) error {
+	if strings.HasSuffix(upload.FileName, ".zip") || strings.HasSuffix(upload.FileName, ".dem.bz2") {
+		return nil
+	}
+
+	r, err := openDemoNamed(LocalDemoStore{}, upload.TempPath, upload.FileName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = getDemoFormat(bufio.NewReader(r))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidDemo, err.Error())
+	}
+
+	return nil
+}
+
+func checkDemoHeader(path, fileName string) error {
+	r, err := openDemoNamed(LocalDemoStore{}, path, fileName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	p, err := newDemoBackend(r)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	_, err = p.ParseHeader()
+	return err
+}
+
+// Checks the demo's header and moves it from its (local) temp file into
+// the upload folder. Returns the demo's final path
+func placeDemoFile(tempPath, fileName string, c Context) (string, error) {
+	err := checkUploadName(fileName, c)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkDemoHeader(tempPath, fileName)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDemo, err.Error())
+	}
+
+	path := join(c.config.uploadPath, fileName)
+	err = c.store.Put(path, tempPath)
+	if err != nil {
+		return "", err
+	}
+
+	c.demos.add(path)
+	return path, nil
+}
+
+// Moves the demo into place and starts parsing it in the background. The
+// demo is claimed before it's moved so that the file watcher doesn't pick
+// it up first. Returns a nil job if the demo doesn't need parsing. A copy
+// of a demo we already have is only found once the job starts, since
+// that needs the demo to be hashed
+func addDemoFile(tempPath, fileName string, c Context) (*ParseJob, error) {
+	demoId := getDemoFileName(fileName)
+	if !c.coordinator.claimDemo(demoId) {
+		return nil, ErrParseInProgress
+	}
+
+	path, err := placeDemoFile(tempPath, fileName, c)
+	if err != nil {
+		c.coordinator.releaseDemo(demoId)
+		return nil, err
+	}
+
+	job, err := getParseJob(demoId, []string{path}, false, true, c)
+	if err == nil && job != nil {
+		err = queueParseJob(job, 0, c)
+	}
+
+	if err != nil || job == nil {
+		c.coordinator.releaseDemo(demoId)
+		return nil, err
+	}
+
+	go func() {
+		defer c.coordinator.releaseDemo(demoId)
+
+		result := runParseJob(job, c)
+		if result.err != nil {
+			c.logger.Errorf("demo=%s failed to parse new demo: %s", demoId, result.err.Error())
+			return
+		} else if result.skipped {
+			return
+		}
+
+		err := saveParseResults([]ParseResult{result}, join(c.config.dataPath, "heatmaps"), c)
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to save new demo: %s", demoId, err.Error())
+			return
+		}
+
+		c.logger.Infof("demo=%s added demo to database", demoId)
+		autoMergeDemos(c)
+	}()
+
+	return job, nil
+}
+
+func finishUpload(upload *Upload, c Context) (*ParseJob, error) {
+	job, err := addDemoFile(upload.TempPath, upload.FileName, c)
+
+	// Once the demo has been moved into place the upload is
+	// finished, even if the demo couldn't be queued for parsing
+	if _, statErr := os.Stat(upload.TempPath); os.IsNotExist(statErr) {
+		deleteErr := c.db.DeleteUpload(upload.Id)
+		if deleteErr != nil {
+			c.logger.Warnf("upload=%s failed to remove finished upload: %s", upload.Id, deleteErr.Error())
+		}
+	}
+
+	return job, err
+}
+
+func cancelUpload(upload *Upload, c Context) error {
+	err := os.Remove(upload.TempPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return c.db.DeleteUpload(upload.Id)
+}
+
+// Removes uploads that were abandoned part way through
+func cleanStaleUploads(c Context) error {
+	uploads, err := c.db.GetStaleUploads(time.Now().Add(-StaleUploadAge).UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	for _, upload := range uploads {
+		c.logger.Infof("upload=%s removing abandoned upload of %s", upload.Id, upload.FileName)
+		err = cancelUpload(&upload, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var errConnectionDropped = errors.New("connection dropped")
+
+// Sends the first n bytes of the chunk and then fails
+// like a connection that dropped part way through
+type droppedReader struct {
+	r io.Reader
+	n int
+}
+
+func (d *droppedReader) Read(b []byte) (int, error) {
+	if d.n <= 0 {
+		return 0, errConnectionDropped
+	}
+
+	if len(b) > d.n {
+		b = b[:d.n]
+	}
+
+	n, err := d.r.Read(b)
+	d.n -= n
+	return n, err
+}
+
+func newTestUpload(t *testing.T, fileName string, size int64) *Upload {
+	tempPath := filepath.Join(t.TempDir(), ".test.upload")
+	if err := os.WriteFile(tempPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Upload{Id: "test", FileName: fileName, Size: size, TempPath: tempPath}
+}
+
+func TestUploadChunks(t *testing.T) {
+	demo := []byte("HL2DEMO\x00" + strings.Repeat("0123456789", 100))
+	upload := newTestUpload(t, "pug_de_ancient.dem", int64(len(demo)))
+
+	chunk := func(from, to int) io.Reader {
+		return bytes.NewReader(demo[from:to])
+	}
+
+	if err := writeUploadChunk(upload, 0, chunk(0, 300)); err != nil {
+		t.Fatalf("first chunk: %v", err)
+	}
+	if upload.Received != 300 {
+		t.Fatalf("received %d bytes, want 300", upload.Received)
+	}
+
+	// The client retries a chunk that we already have
+	if err := writeUploadChunk(upload, 0, chunk(0, 300)); err != ErrUploadOffsetMismatch {
+		t.Fatalf("repeated chunk returned %v, want %v", err, ErrUploadOffsetMismatch)
+	}
+
+	// Or skips ahead
+	if err := writeUploadChunk(upload, 600, chunk(600, 900)); err != ErrUploadOffsetMismatch {
+		t.Fatalf("chunk from the future returned %v, want %v", err, ErrUploadOffsetMismatch)
+	}
+
+	// The connection drops half way through, what made it is kept
+	err := writeUploadChunk(upload, 300, &droppedReader{r: chunk(300, 600), n: 120})
+	if err != errConnectionDropped {
+		t.Fatalf("dropped chunk returned %v, want %v", err, errConnectionDropped)
+	}
+	if upload.Received != 420 {
+		t.Fatalf("received %d bytes after the dropped chunk, want 420", upload.Received)
+	}
+
+	// And the client picks up from wherever the upload got to
+	resumed := &Upload{Id: upload.Id, FileName: upload.FileName, Size: upload.Size, TempPath: upload.TempPath}
+	if err := getUploadProgress(resumed); err != nil || resumed.Received != 420 {
+		t.Fatalf("got progress %d (%v), want 420", resumed.Received, err)
+	}
+
+	if err := writeUploadChunk(resumed, 420, chunk(420, len(demo))); err != nil {
+		t.Fatalf("last chunk: %v", err)
+	}
+
+	data, err := os.ReadFile(upload.TempPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, demo) {
+		t.Fatal("reassembled upload doesn't match the demo")
+	}
+}
+
+func TestUploadTooLarge(t *testing.T) {
+	upload := newTestUpload(t, "pug_de_ancient.dem", 100)
+
+	if err := writeUploadChunk(upload, 0, strings.NewReader(strings.Repeat("a", 60))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Anything past the size the upload was created with is refused
+	// and the upload is left how it was before the chunk
+	err := writeUploadChunk(upload, 60, strings.NewReader(strings.Repeat("b", 41)))
+	if err != ErrUploadTooLarge {
+		t.Fatalf("got %v, want %v", err, ErrUploadTooLarge)
+	}
+
+	if err := getUploadProgress(upload); err != nil || upload.Received != 60 {
+		t.Fatalf("got progress %d (%v), want 60", upload.Received, err)
+	}
+
+	if err := writeUploadChunk(upload, 60, strings.NewReader(strings.Repeat("b", 40))); err != nil {
+		t.Fatalf("chunk that exactly fills the upload: %v", err)
+	}
+}
+
+func TestUploadStart(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("HL2DEMO\x00"))
+	gw.Close()
+
+	tests := []struct {
+		fileName string
+		start    []byte
+		valid    bool
+	}{
+		{"pug_de_ancient.dem", []byte("HL2DEMO\x00partial"), true},
+		{"pug_de_ancient.dem", []byte("PBDEMS2\x00partial"), true},
+		{"pug_de_ancient.dem", []byte("<html>not a demo</html>"), false},
+		{"pug_de_ancient.dem.gz", gz.Bytes(), true},
+		// Can't be checked until they're complete
+		{"pug_de_ancient.zip", []byte("PK\x03\x04"), true},
+	}
+
+	for _, test := range tests {
+		upload := newTestUpload(t, test.fileName, 1000)
+		if err := os.WriteFile(upload.TempPath, test.start, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		err := checkUploadStart(upload)
+		if test.valid && err != nil {
+			t.Errorf("%s %q: got error %v", test.fileName, test.start, err)
+		} else if !test.valid && !errors.Is(err, ErrInvalidDemo) {
+			t.Errorf("%s %q: got %v, want %v", test.fileName, test.start, err, ErrInvalidDemo)
+		}
+	}
+}
+
+func TestUploadNames(t *testing.T) {
+	tests := map[string]bool{
+		"pug_de_ancient.dem":       true,
+		"pug_de_ancient.dem.gz":    true,
+		"pug_de_ancient.dem.bz2":   true,
+		"pug_de_ancient.zip":       true,
+		"pug_de_ancient.txt":       false,
+		".dem":                     false,
+		".hidden.dem":              false,
+		"../pug_de_ancient.dem":    false,
+		"pugs/pug_de_ancient.dem":  false,
+		"pugs\\pug_de_ancient.dem": false,
+	}
+
+	for name, want := range tests {
+		if got := isValidUploadName(name); got != want {
+			t.Errorf("isValidUploadName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
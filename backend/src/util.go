@@ -21,12 +21,9 @@ package main
 
 import (
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
-	"time"
 
-	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
 	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 )
 
@@ -53,11 +50,14 @@ func isLikelyFile(path string) bool {
 		strings.HasSuffix(path, ".txt")
 }
 
+// Cleans up the path (e.g. "/demos/./pugs/" becomes "/demos/pugs") so
+// that folders can be compared with each other and with the paths of
+// the files inside of them
 func normalizeFolderPath(path string) string {
-	if strings.HasSuffix(path, "/") {
-		return path[:len(path)-1]
+	if path == "" {
+		return ""
 	}
-	return path
+	return strings.TrimSuffix(filepath.Clean(path), "/")
 }
 
 func mapValTotal(m *PlayerIntMap) int {
@@ -95,7 +95,61 @@ func headToHeadTotal(h *[]map[uint64]map[uint64]Kill) map[uint64]PlayerIntMap {
 	return ret
 }
 
-func processWeaponName(w common.Equipment) string {
+func weaponMapTotal(a *[]PlayerWeaponMap) PlayerWeaponMap {
+	ret := make(PlayerWeaponMap)
+	for _, m := range *a {
+		for player, weapons := range m {
+			for weapon, stats := range weapons {
+				addWeaponStats(ret, player, weapon, stats)
+			}
+		}
+	}
+	return ret
+}
+
+func addWeaponStats(m PlayerWeaponMap, player uint64, weapon string, delta WeaponStats) {
+	if m[player] == nil {
+		m[player] = make(map[string]WeaponStats)
+	}
+
+	stats := m[player][weapon]
+	stats.Kills += delta.Kills
+	stats.Headshots += delta.Headshots
+	stats.Damage += delta.Damage
+	stats.ShotsFired += delta.ShotsFired
+	stats.Hits += delta.Hits
+	m[player][weapon] = stats
+}
+
+// Grenades, knives and the bomb aren't interesting for the per-weapon stats
+func isGun(w *DemoWeapon) bool {
+	if w == nil {
+		return false
+	}
+
+	switch w.Type.Class() {
+	case common.EqClassPistols, common.EqClassSMG, common.EqClassHeavy, common.EqClassRifle:
+		return true
+	}
+
+	return w.Type == common.EqZeus
+}
+
+func isFirstBullet(prev *Shot, weapon common.EquipmentType, timeMs int64) bool {
+	return prev == nil || prev.Weapon != weapon || timeMs-prev.TimeMs >= FirstBulletResetMs
+}
+
+func heatmapsTotal(h *[]HeatmapData) HeatmapData {
+	ret := make(HeatmapData)
+	for _, m := range *h {
+		for dataSet, points := range m {
+			ret[dataSet] = append(ret[dataSet], points...)
+		}
+	}
+	return ret
+}
+
+func processWeaponName(w DemoWeapon) string {
 	toReplace := [][]string{
 		{"models/weapons/", ""},
 		{"v_", ""},
@@ -141,7 +195,7 @@ func getPlayers(teams TeamsMap, playerNames NamesMap, hltv PlayerF64Map, side st
 	return ret
 }
 
-func getScore(rounds []Round, endSide string, toRound, halfLength int) (int, string) {
+func getScore(rounds []Round, endSide string, toRound, halfLength, overtimeHalfLength int) (int, string) {
 	score := 0
 	currSide := endSide
 	roundSide := ""
@@ -151,12 +205,9 @@ func getScore(rounds []Round, endSide string, toRound, halfLength int) (int, str
 	for i := len(rounds); i > 0; i-- {
 		round := rounds[i-1]
 
-		// Switch sides at half time and during overtime
-		//
-		// We will assume that overtime for short matches is 3 rounds per half,
-		// I've never actually seen a short match with overtime so who knows if this
-		// condition will ever even be triggered
-		if i == halfLength || (i > halfLength*2 && (i-3)%6 == 0) {
+		// Switch sides at half time and at the half of each overtime. The
+		// teams keep their sides going from one overtime into the next
+		if isSideSwitchRound(i, halfLength, overtimeHalfLength) {
 			if currSide == "T" {
 				currSide = "CT"
 			} else {
@@ -179,59 +230,27 @@ func getScore(rounds []Round, endSide string, toRound, halfLength int) (int, str
 	return score, roundSide
 }
 
-func getDemoFileName(path string) string {
-	return strings.Replace(path[strings.LastIndex(path, "/")+1:], ".dem", "", 1)
-}
-
-func getDemoType(demoFileName string) string {
-	if strings.HasPrefix(demoFileName, "esea") {
-		return "esea"
-	} else if strings.HasPrefix(demoFileName, "pug_") {
-		return "pugsetup"
-	} else if strings.HasPrefix(demoFileName, "1-") {
-		return "faceit"
-	} else {
-		return "steam"
-	}
-}
-
-var (
-	DateRegex1 = regexp.MustCompile(`(\d\d\d\d)-(\d\d)-(\d\d)`)
-	DateRegex2 = regexp.MustCompile(`(\d\d\d\d)_(\d\d)_(\d\d)`)
-	DateRegex3 = regexp.MustCompile(`(\d\d\d\d)/(\d\d)/(\d\d)`)
-)
-
-func getDemoTime(config Config, logger *Logger, demoFileName string) time.Time {
-	matches := DateRegex1.FindStringSubmatch(demoFileName)
-	if matches == nil {
-		matches = DateRegex2.FindStringSubmatch(demoFileName)
+// Whether the sides are switched after the given (1-indexed) round
+func isSideSwitchRound(round, halfLength, overtimeHalfLength int) bool {
+	if round == halfLength {
+		return true
 	}
 
-	if matches == nil {
-		matches = DateRegex3.FindStringSubmatch(demoFileName)
+	if overtimeHalfLength <= 0 || round <= halfLength*2 {
+		return false
 	}
 
-	defaultTime := time.Now()
-	if matches != nil {
-		// TODO: should probably come back to this and be a
-		// little smarter about which matched field is the day
-		// and which is the month
-		loc, err := time.LoadLocation(config.timezone)
-		if err != nil {
-			logger.Errorf("failed to load timezone: %s", err.Error())
-			return defaultTime
-		}
+	return (round-halfLength*2-overtimeHalfLength)%(overtimeHalfLength*2) == 0
+}
 
-		time, err := time.ParseInLocation("2006-01-02", matches[1]+"-"+matches[2]+"-"+matches[3], loc)
-		if err != nil {
-			logger.Errorf("failed to parse time: %s", err.Error())
-			return defaultTime
+func getDemoFileName(path string) string {
+	fileName := path[strings.LastIndex(path, "/")+1:]
+	for _, ext := range DemoExtensions {
+		if strings.HasSuffix(fileName, ext) {
+			return strings.TrimSuffix(fileName, ext)
 		}
-
-		return time
 	}
-
-	return defaultTime
+	return fileName
 }
 
 func getTeamName(
@@ -289,36 +308,32 @@ Outer:
 }
 
 func updateTeams(
-	p *dem.Parser,
+	gs DemoGameState,
 	teams *TeamsMap,
 	ctClanTag, tClanTag *string,
 	leavers map[uint64]uint64,
 ) {
 	// If the teams have custom names we will use those
-	tTag := (*p).GameState().TeamTerrorists().ClanName()
-	ctTag := (*p).GameState().TeamCounterTerrorists().ClanName()
+	tTeam := gs.Team("T")
+	ctTeam := gs.Team("CT")
 
-	if tTag != "" && ctTag != "" {
-		*tClanTag = tTag
-		*ctClanTag = ctTag
+	if tTeam != nil && ctTeam != nil && tTeam.ClanName != "" && ctTeam.ClanName != "" {
+		*tClanTag = tTeam.ClanName
+		*ctClanTag = ctTeam.ClanName
 	}
 
-	for _, player := range (*p).GameState().Participants().All() {
+	for _, player := range gs.Participants() {
 		if !player.IsConnected {
 			continue
 		}
 
 		playerId := unBotify(player.SteamID64)
 
-		switch player.Team {
-		case common.TeamSpectators:
-			delete(*teams, playerId)
-		case common.TeamUnassigned:
+		switch player.Side {
+		case "CT", "T":
+			(*teams)[playerId] = player.Side
+		default:
 			delete(*teams, playerId)
-		case common.TeamCounterTerrorists:
-			(*teams)[playerId] = "CT"
-		case common.TeamTerrorists:
-			(*teams)[playerId] = "T"
 		}
 	}
 
@@ -327,8 +342,69 @@ func updateTeams(
 	}
 }
 
-func updatePlayerNames(p *dem.Parser, playerNames *NamesMap) {
-	for _, player := range (*p).GameState().Participants().Playing() {
+func getSideName(team common.Team) string {
+	switch team {
+	case common.TeamCounterTerrorists:
+		return "CT"
+	case common.TeamTerrorists:
+		return "T"
+	}
+	return ""
+}
+
+func getTeamEconomy(team *DemoTeam) TeamEconomy {
+	if team == nil {
+		return TeamEconomy{}
+	}
+
+	startMoney := 0
+	for _, player := range team.Members {
+		// Money has already had the freeze time purchases taken out of it
+		startMoney += player.Money + player.MoneySpentThisRound
+	}
+
+	return TeamEconomy{
+		EquipmentValue: team.FreezeTimeEndEquipmentValue,
+		MoneySpent:     team.MoneySpentThisRound,
+		StartMoney:     startMoney,
+	}
+}
+
+// Checks whether the victim's death has left either team with a single
+// player alive. The victim's own team is checked first so that a kill
+// resulting in a 1v1 is attributed to the player who was just left alone
+func detectClutch(gs DemoGameState, victim *DemoPlayer) *Clutch {
+	alive := make(map[string][]*DemoPlayer)
+	for _, player := range gs.Playing() {
+		// The victim's health isn't guaranteed to be updated by the time
+		// the kill event fires so we will exclude them explicitly
+		if player.EntityId == victim.EntityId || !player.IsAlive {
+			continue
+		}
+		alive[player.Side] = append(alive[player.Side], player)
+	}
+
+	sides := []string{victim.Side, "CT", "T"}
+	for _, side := range sides {
+		if side != "CT" && side != "T" {
+			continue
+		}
+
+		opponents := len(alive["CT"]) + len(alive["T"]) - len(alive[side])
+		if len(alive[side]) == 1 && opponents > 0 {
+			return &Clutch{
+				Player:    unBotify(alive[side][0].SteamID64),
+				Side:      side,
+				Opponents: opponents,
+			}
+		}
+	}
+
+	return nil
+}
+
+func updatePlayerNames(gs DemoGameState, playerNames *NamesMap) {
+	for _, player := range gs.Playing() {
 		if player.IsBot {
 			(*playerNames)[unBotify(player.SteamID64)] = "BOT " + player.Name
 		} else {
@@ -20,7 +20,9 @@
 package main
 
 import (
-	"strings"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -30,7 +32,31 @@ type FileRename struct {
 	old, new string
 }
 
-func watchDemoDir(watchDir string, newFile chan<- string, renamedFile chan<- FileRename, logger *Logger) error {
+// fsnotify doesn't watch subdirectories so each directory under
+// the root has to be added to the watcher separately. Returns the
+// demos that are already in the directories
+func watchRecursive(watcher *fsnotify.Watcher, root string) ([]string, error) {
+	demos := make([]string, 0)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return watcher.Add(path)
+		}
+
+		if isDemoFile(path) {
+			demos = append(demos, path)
+		}
+
+		return nil
+	})
+
+	return demos, err
+}
+
+func watchDemoDirs(watchDirs []string, newFile chan<- string, renamedFile chan<- FileRename, removedFile chan<- string, logger *Logger) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		logger.Error(err)
@@ -43,6 +69,39 @@ func watchDemoDir(watchDir string, newFile chan<- string, renamedFile chan<- Fil
 	go func() {
 		var prev *fsnotify.Event
 		timers := make(map[string]*time.Timer, 10)
+
+		// only send to the channel after we have stopped receiving
+		// write events for 3 seconds
+		queueNewFile := func(path string) {
+			if timers[path] == nil {
+				timers[path] = time.NewTimer(3 * time.Second)
+				go func() {
+					<-timers[path].C
+					newFile <- path
+					delete(timers, path)
+				}()
+			} else {
+				timers[path].Reset(3 * time.Second)
+			}
+		}
+
+		// Some programs overwrite a file by deleting it and creating
+		// it again, so only count the demo as removed if it's still
+		// gone after a few seconds
+		queueRemovedFile := func(path string) *time.Timer {
+			return time.AfterFunc(3*time.Second, func() {
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					removedFile <- path
+				}
+			})
+		}
+
+		// A demo that's moved out of the folders we watch only gets a
+		// rename event. If it was moved somewhere else inside of them
+		// the create event for its new name comes straight after and
+		// the removal is cancelled
+		var pendingRemoval *time.Timer
+
 		for {
 			select {
 			case event, ok := <-watcher.Events:
@@ -52,28 +111,48 @@ func watchDemoDir(watchDir string, newFile chan<- string, renamedFile chan<- Fil
 				}
 
 				path := event.Name
-				if !strings.HasSuffix(path, ".dem") {
+
+				// Directories created (or moved in) after we started need to
+				// be watched as well. Anything inside of a directory that was
+				// moved in won't get its own events so it's picked up here
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if info, err := os.Stat(path); err == nil && info.IsDir() {
+						demos, err := watchRecursive(watcher, path)
+						if err != nil {
+							logger.Errorf("failed to watch new directory %s: %s", path, err.Error())
+						}
+
+						for _, demo := range demos {
+							queueNewFile(demo)
+						}
+
+						prev = &event
+						continue
+					}
+				}
+
+				if !isDemoFile(path) {
 					continue
 				}
 
+				if event.Op&fsnotify.Remove == fsnotify.Remove {
+					queueRemovedFile(path)
+				}
+
+				if event.Op&fsnotify.Rename == fsnotify.Rename {
+					pendingRemoval = queueRemovedFile(path)
+				}
+
 				if event.Op&fsnotify.Create == fsnotify.Create ||
 					event.Op&fsnotify.Write == fsnotify.Write {
 
 					if prev != nil && prev.Op&fsnotify.Rename == fsnotify.Rename {
+						if pendingRemoval != nil {
+							pendingRemoval.Stop()
+						}
 						renamedFile <- FileRename{old: prev.Name, new: path}
 					} else {
-						// only send to the channel after we have stopped receiving
-						// write events for 3 seconds
-						if timers[path] == nil {
-							timers[path] = time.NewTimer(3 * time.Second)
-							go func() {
-								<-timers[path].C
-								newFile <- path
-								delete(timers, path)
-							}()
-						} else {
-							timers[path].Reset(3 * time.Second)
-						}
+						queueNewFile(path)
 					}
 				}
 
@@ -88,11 +167,111 @@ func watchDemoDir(watchDir string, newFile chan<- string, renamedFile chan<- Fil
 		}
 	}()
 
-	err = watcher.Add(watchDir)
+	for _, watchDir := range watchDirs {
+		_, err = watchRecursive(watcher, watchDir)
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+
+	<-done
+	return nil
+}
+
+type polledFile struct {
+	size    int64
+	modTime time.Time
+	// Whether the file has been sent to the newFile channel yet
+	reported bool
+}
+
+func pollDemoFiles(store DemoStore, watchDirs []string) (map[string]polledFile, error) {
+	files := make(map[string]polledFile)
+	for _, watchDir := range watchDirs {
+		objects, err := store.List(watchDir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range objects {
+			if isDemoFile(filepath.Base(object.Path)) {
+				files[object.Path] = polledFile{size: object.Size, modTime: object.ModTime}
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// For filesystems that don't support inotify (e.g. SMB or NFS mounts) and
+// demo stores that aren't on the local filesystem at all. The
+// folders are listed every interval and a new demo is only sent on once its
+// size and modification time have stayed the same for a whole interval, so
+// demos which are still being copied over aren't picked up early. A demo
+// that disappears in the same interval that an identical one shows up is
+// treated as a rename, otherwise it's sent on as removed
+func pollDemoDirs(store DemoStore, watchDirs []string, interval time.Duration, newFile chan<- string, renamedFile chan<- FileRename, removedFile chan<- string, logger *Logger) error {
+	// Anything that's already there will be picked up by the rescan
+	known, err := pollDemoFiles(store, watchDirs)
 	if err != nil {
 		logger.Error(err)
+		return err
+	}
+
+	for path, file := range known {
+		file.reported = true
+		known[path] = file
+	}
+
+	for range time.Tick(interval) {
+		current, err := pollDemoFiles(store, watchDirs)
+		if err != nil {
+			// Network mounts can drop out for a bit. Skip this round
+			// rather than treating all of the demos as removed
+			logger.Warnf("failed to poll demo folders: %s", err.Error())
+			continue
+		}
+
+		gone := make(map[string]polledFile)
+		for path, file := range known {
+			if _, ok := current[path]; !ok && file.reported {
+				gone[path] = file
+			}
+		}
+
+		for path, file := range current {
+			previous, ok := known[path]
+			if !ok {
+				for oldPath, oldFile := range gone {
+					if oldFile.size == file.size && oldFile.modTime.Equal(file.modTime) {
+						renamedFile <- FileRename{old: oldPath, new: path}
+						delete(gone, oldPath)
+						file.reported = true
+						break
+					}
+				}
+
+				current[path] = file
+				continue
+			}
+
+			stable := previous.size == file.size && previous.modTime.Equal(file.modTime)
+			if stable && !previous.reported {
+				newFile <- path
+				file.reported = true
+			} else if stable {
+				file.reported = previous.reported
+			}
+
+			current[path] = file
+		}
+
+		for path := range gone {
+			removedFile <- path
+		}
+
+		known = current
 	}
 
-	<-done
 	return nil
 }
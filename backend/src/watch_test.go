@@ -0,0 +1,84 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchDemoDirsRenames(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	for _, name := range []string{"moved_out.dem", "renamed.dem"} {
+		err := os.WriteFile(filepath.Join(root, name), []byte("HL2DEMO\x00"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newFile := make(chan string, 10)
+	renamedFile := make(chan FileRename, 10)
+	removedFile := make(chan string, 10)
+	go watchDemoDirs([]string{root}, newFile, renamedFile, removedFile, newLogger(false))
+
+	// Give the watcher a moment to add the directory
+	time.Sleep(200 * time.Millisecond)
+
+	err := os.Rename(filepath.Join(root, "renamed.dem"), filepath.Join(root, "renamed_2.dem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Rename(filepath.Join(root, "moved_out.dem"), filepath.Join(outside, "moved_out.dem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case renamed := <-renamedFile:
+		if renamed.old != filepath.Join(root, "renamed.dem") || renamed.new != filepath.Join(root, "renamed_2.dem") {
+			t.Errorf("unexpected rename %+v", renamed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("rename inside of the demo folder wasn't reported")
+	}
+
+	select {
+	case removed := <-removedFile:
+		if removed != filepath.Join(root, "moved_out.dem") {
+			t.Errorf("unexpected removal of %s", removed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("demo moved out of the demo folder wasn't reported as removed")
+	}
+
+	// The renamed demo shouldn't also be reported as removed
+	select {
+	case removed := <-removedFile:
+		t.Errorf("unexpected removal of %s", removed)
+	case path := <-newFile:
+		t.Errorf("unexpected new file %s", path)
+	case <-time.After(time.Second):
+	}
+}
@@ -35,6 +35,87 @@ export type AuditEntry = {
   description: string;
 };
 
+export type ParseJobStatus = "queued" | "running" | "done" | "failed";
+
+export type ParseJob = {
+  id: number;
+  demoId: string;
+  rescanId: number | null;
+  status: ParseJobStatus;
+  error: string;
+  queuedAt: number;
+  startedAt: number | null;
+  finishedAt: number | null;
+};
+
+export type RescanProgress = {
+  id: number;
+  trigger: string;
+  startedAt: number;
+  finishedAt: number | null;
+  total: number;
+  queued: number;
+  running: number;
+  done: number;
+  failed: number;
+};
+
+export type ParseFailure = {
+  demoId: string;
+  error: string;
+  attempts: number;
+  firstFailedAt: number;
+  lastFailedAt: number;
+  nextRetryAt: number | null;
+};
+
+export type DuplicateDemo = {
+  demoId: string;
+  matchId: string;
+  contentHash: string;
+  detectedAt: number;
+};
+
+export type Upload = {
+  id: string;
+  username: string;
+  fileName: string;
+  size: number;
+  createdAt: number;
+  updatedAt: number;
+  received: number;
+};
+
+export type UploadChunkResult = {
+  offset: number;
+  done: boolean;
+  demoId?: string;
+  jobId?: number;
+};
+
+export type DemoImportStatus = "queued" | "downloading" | "done" | "failed";
+
+export type DemoImport = {
+  id: number;
+  url: string;
+  username: string | null;
+  status: DemoImportStatus;
+  demoId: string;
+  received: number;
+  total: number | null;
+  error: string;
+  parseJobId: number | null;
+  createdAt: number;
+  finishedAt: number | null;
+};
+
+export type MatchPart = {
+  matchId: string;
+  demoId: string;
+  part: number;
+  automatic: boolean;
+};
+
 export type RegisterInput = {
   username: string;
   password: string;
@@ -50,7 +131,21 @@ export type FrontendOptions = {
   matchVisibility: "public" | "private";
 };
 
-type ErrorCode = 400 | 401 | 403 | 404 | 405 | 418 | 429 | 500 | 501 | 502;
+type ErrorCode =
+  | 400
+  | 401
+  | 403
+  | 404
+  | 405
+  | 409
+  | 418
+  | 429
+  | 500
+  | 501
+  | 502;
+
+// Has to fit within any request body limits of a reverse proxy
+const UPLOAD_CHUNK_SIZE = 8 * 1024 * 1024;
 
 let _api: DataAPI;
 export const api = (): DataAPI => {
@@ -138,6 +233,32 @@ class DataAPI {
     return { code, res: json.message as T };
   }
 
+  // Same as fetchAuthed but sends the body as is instead of as JSON
+  private async fetchAuthedRaw<T>(
+    method: "PUT" | "PATCH",
+    url: string,
+    body: Blob
+  ): Promise<{ code: 200; res: T } | { code: ErrorCode; error: string }> {
+    const token = this.getLoginToken();
+    if (token === null) {
+      return { code: 401, error: "Not logged in" };
+    }
+
+    const res = await fetch(`${this.endpoint}${url}`, {
+      method: method,
+      headers: {
+        "Content-Type": "application/octet-stream",
+        Authorization: `Bearer ${token}`,
+      },
+      body,
+    });
+
+    const json = await res.json();
+    const code = res.status;
+    if (code !== 200) return { code: code as ErrorCode, error: json.error };
+    return { code, res: json.message as T };
+  }
+
   /********************************************************/
   /*                    Public Methods                    */
   /********************************************************/
@@ -432,4 +553,260 @@ class DataAPI {
     }
     return r.res;
   }
+
+  public async rescanProgress(): Promise<RescanProgress> {
+    const r = await this.fetchAuthed<RescanProgress>("GET", `/rescan`);
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to fetch rescan progress (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async parseJobs(
+    limit: number,
+    offset: number,
+    status?: ParseJobStatus
+  ): Promise<ParseJob[]> {
+    const statusQ = status !== undefined ? `&status=${status}` : "";
+    const r = await this.fetchAuthed<ParseJob[]>(
+      "GET",
+      `/parsejobs?limit=${limit}&offset=${offset}${statusQ}`
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to fetch parse jobs (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async demoParseJobs(id: string): Promise<ParseJob[]> {
+    const r = await this.fetchAuthed<ParseJob[]>(
+      "GET",
+      `/parsejobs/demo/${encodeURIComponent(id)}`
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to fetch parse jobs for demo (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async brokenDemos(
+    limit: number,
+    offset: number
+  ): Promise<ParseFailure[]> {
+    const r = await this.fetchAuthed<ParseFailure[]>(
+      "GET",
+      `/brokenDemos?limit=${limit}&offset=${offset}`
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to fetch broken demos (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async duplicateDemos(
+    limit: number,
+    offset: number
+  ): Promise<DuplicateDemo[]> {
+    const r = await this.fetchAuthed<DuplicateDemo[]>(
+      "GET",
+      `/duplicateDemos?limit=${limit}&offset=${offset}`
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to fetch duplicate demos (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async importDemos(urls: string[]): Promise<DemoImport[]> {
+    const r = await this.fetchAuthed<DemoImport[]>("POST", `/imports`, {
+      urls,
+    });
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to import demos (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async demoImports(
+    limit: number,
+    offset: number
+  ): Promise<DemoImport[]> {
+    const r = await this.fetchAuthed<DemoImport[]>(
+      "GET",
+      `/imports?limit=${limit}&offset=${offset}`
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to fetch imports (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async demoImport(id: number): Promise<DemoImport> {
+    const r = await this.fetchAuthed<DemoImport>("GET", `/imports/${id}`);
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to fetch import (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async retryParseJobs(id?: string): Promise<void> {
+    const path =
+      id !== undefined
+        ? `/parsejobs/retry/${encodeURIComponent(id)}`
+        : `/parsejobs/retry`;
+    const r = await this.fetchAuthed<string>("PUT", path);
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to retry parse jobs (HTTP ${r.code}): ${r.error}`
+      );
+    }
+  }
+
+  public async matchParts(id: string): Promise<MatchPart[]> {
+    const r = await this.fetchAuthed<MatchPart[]>(
+      "GET",
+      `/matchparts/${encodeURIComponent(id)}`
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to fetch match parts (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async mergeDemos(demos: string[]): Promise<void> {
+    const r = await this.fetchAuthed<string>("PUT", `/matchparts`, { demos });
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to merge demos (HTTP ${r.code}): ${r.error}`
+      );
+    }
+  }
+
+  public async splitMatch(id: string): Promise<void> {
+    const r = await this.fetchAuthed<string>(
+      "DELETE",
+      `/matchparts/${encodeURIComponent(id)}`
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to split match (HTTP ${r.code}): ${r.error}`
+      );
+    }
+  }
+
+  public async createUpload(fileName: string, size: number): Promise<Upload> {
+    const r = await this.fetchAuthed<Upload>("POST", `/uploads`, {
+      fileName,
+      size,
+    });
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to start upload (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async uploadStatus(id: string): Promise<Upload> {
+    const r = await this.fetchAuthed<Upload>(
+      "GET",
+      `/uploads/${encodeURIComponent(id)}`
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to fetch upload status (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async uploadChunk(
+    id: string,
+    offset: number,
+    chunk: Blob
+  ): Promise<UploadChunkResult> {
+    const r = await this.fetchAuthedRaw<UploadChunkResult>(
+      "PATCH",
+      `/uploads/${encodeURIComponent(id)}?offset=${offset}`,
+      chunk
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to upload chunk (HTTP ${r.code}): ${r.error}`
+      );
+    }
+    return r.res;
+  }
+
+  public async cancelUpload(id: string): Promise<void> {
+    const r = await this.fetchAuthed<string>(
+      "DELETE",
+      `/uploads/${encodeURIComponent(id)}`
+    );
+    if (r.code !== 200) {
+      throw new APIError(
+        r.code,
+        `Failed to cancel upload (HTTP ${r.code}): ${r.error}`
+      );
+    }
+  }
+
+  // Uploads the demo in chunks. If a chunk fails the upload can be
+  // resumed by passing the ID of the upload that was started
+  public async uploadDemo(
+    file: File,
+    onProgress?: (upload: Upload) => void,
+    uploadId?: string
+  ): Promise<UploadChunkResult> {
+    const upload =
+      uploadId !== undefined
+        ? await this.uploadStatus(uploadId)
+        : await this.createUpload(file.name, file.size);
+
+    let offset = upload.received;
+    let result: UploadChunkResult;
+    do {
+      const chunk = file.slice(offset, offset + UPLOAD_CHUNK_SIZE);
+      result = await this.uploadChunk(upload.id, offset, chunk);
+      offset = result.offset;
+      if (onProgress) {
+        onProgress({ ...upload, received: offset });
+      }
+    } while (!result.done);
+
+    return result;
+  }
 }
@@ -21,7 +21,7 @@ import { DemoType, MatchData, Stats, Team } from "./types";
 import { format } from "date-fns";
 
 export const BOT_ID = "72057598465171267";
-export const ROLES = ["admin"];
+export const ROLES = ["admin", "uploader"];
 
 export const getPlayers = (
   data: MatchData,
@@ -18,6 +18,7 @@
  */
 
 import {
+  Badge,
   Box,
   Container,
   Divider,
@@ -95,6 +96,18 @@ const TableRow = (props: {
             />
           </Skeleton>
           {match.map}
+          {match.tags.map((tag) => (
+            <Badge key={tag} ml={2}>
+              {tag}
+            </Badge>
+          ))}
+          {match.sourceUrl && (
+            <Tooltip label={`Imported from ${match.sourceUrl}`}>
+              <Badge ml={2} colorScheme="blue">
+                Imported
+              </Badge>
+            </Tooltip>
+          )}
         </Flex>
       </RowLink>
       <RowLink to={url} textAlign="left" whiteSpace="nowrap">
@@ -105,6 +118,20 @@ const TableRow = (props: {
       </RowLink>
       <RowLink to={url} textAlign="center">
         {match.teamAScore}:{match.teamBScore}
+        {match.incomplete && (
+          <Tooltip label={`Incomplete demo: ${match.incompleteReason}`}>
+            <Badge ml={2} colorScheme="orange">
+              Incomplete
+            </Badge>
+          </Tooltip>
+        )}
+        {match.demoMissing && (
+          <Tooltip label="The demo file has been removed from the demos folder">
+            <Badge ml={2} colorScheme="red">
+              Demo missing
+            </Badge>
+          </Tooltip>
+        )}
       </RowLink>
       <RowLink to={url}>{match.teamBTitle}</RowLink>
       <Td>
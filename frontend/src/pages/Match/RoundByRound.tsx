@@ -59,7 +59,8 @@ type KillFeedThing = {
 const playerColor = (
   startTeam: Team | undefined,
   round: number,
-  halfLength: number
+  halfLength: number,
+  overtimeHalfLength: number
 ) => {
   if (startTeam === undefined) return "white";
 
@@ -68,13 +69,16 @@ const playerColor = (
   } else if (round <= halfLength * 2) {
     return KILLFEED_COLORS_MAP[INVERT_TEAM[startTeam]];
   } else {
-    const ot = Math.ceil((round - halfLength * 2) / 6);
-    const otRound = ((round - 1) % 6) + 1;
+    const overtimeLength = overtimeHalfLength * 2;
+    const ot = Math.ceil((round - halfLength * 2) / overtimeLength);
+    const otRound = ((round - halfLength * 2 - 1) % overtimeLength) + 1;
     let side;
     if (ot % 2 === 0) {
-      side = otRound <= 3 ? startTeam : INVERT_TEAM[startTeam];
+      side =
+        otRound <= overtimeHalfLength ? startTeam : INVERT_TEAM[startTeam];
     } else {
-      side = otRound <= 3 ? INVERT_TEAM[startTeam] : startTeam;
+      side =
+        otRound <= overtimeHalfLength ? INVERT_TEAM[startTeam] : startTeam;
     }
     return KILLFEED_COLORS_MAP[side];
   }
@@ -127,6 +131,8 @@ const KillFeedItem = (
     startTeams: TeamsMap;
     playerNames: PlayerNames;
     halfLength: number;
+  overtimeHalfLength: number;
+    overtimeHalfLength: number;
   }
 ) => {
   const { kill, round, startTeams, playerNames } = props;
@@ -138,7 +144,8 @@ const KillFeedItem = (
         color={playerColor(
           startTeams[props.killer.toString()],
           round,
-          props.halfLength
+          props.halfLength,
+          props.overtimeHalfLength
         )}
       />
 
@@ -153,7 +160,8 @@ const KillFeedItem = (
             color={playerColor(
               startTeams[kill.assister.toString()],
               round,
-              props.halfLength
+              props.halfLength,
+              props.overtimeHalfLength
             )}
           />
         </>
@@ -171,7 +179,8 @@ const KillFeedItem = (
         color={playerColor(
           startTeams[props.victim.toString()],
           round,
-          props.halfLength
+          props.halfLength,
+          props.overtimeHalfLength
         )}
       />
       <KillLocation>{props.kill.victimLocation}</KillLocation>
@@ -204,6 +213,7 @@ const EventsFeed = (props: {
   playerNames: PlayerNames;
   round: number;
   halfLength: number;
+  overtimeHalfLength: number;
 }) => (
   <Flex flexDirection="column" alignItems="start" mt={2} overflowX="auto">
     {props.events.map((event, j) => {
@@ -221,6 +231,7 @@ const EventsFeed = (props: {
               playerNames={props.playerNames}
               round={props.round}
               halfLength={props.halfLength}
+              overtimeHalfLength={props.overtimeHalfLength}
             />
           )}
 
@@ -251,11 +262,19 @@ export const RoundByRoundList = (props: {
   playerNames: PlayerNames;
   rounds: Round[];
   halfLength: number;
+  overtimeHalfLength: number;
 }) => {
   return (
     <Accordion allowMultiple>
       {props.roundByRound.map((r, i) => {
-        const { teamAScore, teamBScore, teamASide, teamBSide, events } = r;
+        const {
+          teamAScore,
+          teamBScore,
+          teamASide,
+          teamBSide,
+          overtime,
+          events,
+        } = r;
 
         return (
           <AccordionItem key={i}>
@@ -272,6 +291,7 @@ export const RoundByRoundList = (props: {
                       height="1.1rem"
                     >
                       Round {i + 1}
+                      {overtime && ` (OT ${overtime.number})`}
                     </Heading>
 
                     <Flex flex={1} justifyContent="center" alignItems="center">
@@ -317,6 +337,7 @@ export const RoundByRoundList = (props: {
                       playerNames={props.playerNames}
                       round={i + 1}
                       halfLength={props.halfLength}
+                      overtimeHalfLength={props.overtimeHalfLength}
                     />
                   ) : (
                     <></>
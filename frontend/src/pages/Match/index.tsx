@@ -315,6 +315,7 @@ export const MatchPage = () => {
               playerNames={match.meta.playerNames}
               rounds={match.matchData.rounds}
               halfLength={match.matchData.halfLength}
+              overtimeHalfLength={match.matchData.overtimeHalfLength}
             />
           </TabPanel>
         </TabPanels>
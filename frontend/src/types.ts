@@ -47,6 +47,55 @@ export type Round = {
   planterTime: number;
   defuserTime: number;
   bombExplodeTime: number;
+  clutch: Clutch | null;
+};
+
+export type Clutch = {
+  player: string;
+  side: Team;
+  opponents: number;
+  won: boolean;
+};
+
+export type BuyType = "pistol" | "eco" | "force" | "half" | "full";
+
+export type TeamEconomy = {
+  equipmentValue: number;
+  moneySpent: number;
+  startMoney: number;
+  buyType: BuyType;
+};
+
+export type RoundEconomy = {
+  CT: TeamEconomy;
+  T: TeamEconomy;
+};
+
+export type GrenadeType =
+  | "flash"
+  | "he"
+  | "smoke"
+  | "molotov"
+  | "incendiary"
+  | "decoy";
+
+export type FlashedPlayer = {
+  player: string;
+  durationMs: number;
+  teammate: boolean;
+};
+
+export type Grenade = {
+  type: GrenadeType;
+  thrower: string;
+  side: Team;
+  throwTime: number;
+  throwPosition: Position;
+  detonateTime: number;
+  detonatePosition: Position;
+  flashed: FlashedPlayer[];
+  damage: number;
+  smokeDurationMs: number;
 };
 
 export type HeadToHead = { [key: string]: { [key: string]: number } };
@@ -97,9 +146,17 @@ export type RoundByRound = {
   teamBScore: number;
   teamASide: Team;
   teamBSide: Team;
+  overtime: RoundOvertime | null;
   events: RoundEvent[];
 }[];
 
+export type RoundOvertime = {
+  number: number;
+  round: number;
+  teamAScore: number;
+  teamBScore: number;
+};
+
 export type Kill = {
   weapon: string;
   assister: string;
@@ -112,6 +169,13 @@ export type Kill = {
   penetratedObjects: number;
   attackerLocation: string;
   victimLocation: string;
+  attackerPosition: Position;
+  victimPosition: Position;
+};
+
+export type Position = {
+  x: number;
+  y: number;
 };
 
 export type DemoType = "esea" | "pugsetup" | "faceit" | "steam";
@@ -131,6 +195,14 @@ export type MatchInfo = {
   teamBScore: number;
   teamATitle: string;
   teamBTitle: string;
+  demoTypeSource: string;
+  dateSource: string;
+  contentHash: string;
+  tags: string[];
+  demoMissing: boolean;
+  sourceUrl: string;
+  incomplete: boolean;
+  incompleteReason: string;
 };
 
 export type MatchData = {
@@ -139,6 +211,8 @@ export type MatchData = {
   startTeams: TeamsMap;
   rounds: Round[];
   halfLength: number;
+  overtimeHalfLength: number;
+  startRound: number;
   openingKills: OpeningKill[];
 
   stats: Stats;
@@ -146,6 +220,8 @@ export type MatchData = {
   headToHead: HeadToHead;
   killFeed: KillFeed;
   roundByRound: RoundByRound;
+  economy: RoundEconomy[];
+  utility: Grenade[][];
 };
 
 export type Match = {
@@ -153,6 +229,15 @@ export type Match = {
   matchData: MatchData;
 };
 
+export type WeaponStats = {
+  kills: number;
+  headshots: number;
+  damage: number;
+  shotsFired: number;
+  hits: number;
+  accuracy: number;
+};
+
 export type Stats = {
   HEsThrown: NumericMap;
   adr: NumericMap;
@@ -183,6 +268,21 @@ export type Stats = {
   tradeKills: NumericMap;
   utilDamage: NumericMap;
 
+  headDamage: NumericMap;
+  chestDamage: NumericMap;
+  stomachDamage: NumericMap;
+  armDamage: NumericMap;
+  legDamage: NumericMap;
+  shotsFired: NumericMap;
+  shotsHit: NumericMap;
+  accuracy: NumericMap;
+  firstBulletAccuracy: NumericMap;
+
+  weapons: { [key: string]: { [key: string]: WeaponStats } };
+
+  clutchAttempts: { [key: string]: NumericMap };
+  clutchWins: { [key: string]: NumericMap };
+
   "2k": NumericMap;
   "3k": NumericMap;
   "4k": NumericMap;